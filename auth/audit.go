@@ -0,0 +1,64 @@
+package auth
+
+import "time"
+
+// Reasons given in AuditEvents.
+const (
+	AuditReasonAllUsers    = "perm granted to all users"
+	AuditReasonAuthedUsers = "perm granted to authenticated users"
+	AuditReasonAnonymous   = "no username supplied"
+	AuditReasonGranted     = "perm granted"
+	AuditReasonNotGranted  = "perm not granted"
+	AuditReasonSizeLimit   = "request exceeds size limit"
+	AuditReasonLoopback    = "perm bypassed for loopback address"
+	AuditReasonGracePeriod = "perm not granted, but allowed during grace period"
+)
+
+// AuditEvent describes a single authorization decision.
+type AuditEvent struct {
+	Time     time.Time
+	Username string
+	Perm     string
+	Allowed  bool
+
+	// Reason explains the decision. It is one of the AuditReason constants,
+	// or, if authentication failed, the error returned by CheckE.
+	Reason string
+}
+
+// AuditHook is a function called with every authorization decision made by AA
+// and its variants, CheckFromAddr and HasPermRequest.
+type AuditHook func(event AuditEvent)
+
+// SetAuditHook sets the hook called with every authorization decision made by
+// AA and its variants, CheckFromAddr and HasPermRequest, including those
+// granting a perm to anonymous users via AllUsers or loopback addresses. Each
+// decision is reported once, as finally made, so a request denied by
+// AAWithSize for its size is reported as denied. The hook is called without
+// the store's lock held, but synchronously, so a slow hook delays the caller.
+// Passing nil disables auditing, which is the default. The hook is not called
+// while the store is Lean.
+func (c *CredentialsStore) SetAuditHook(hook AuditHook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.auditHook = hook
+}
+
+// audit passes an event describing the given decision to the audit hook, if
+// one is set and the store is not Lean, and returns allowed.
+func (c *CredentialsStore) audit(username, perm string, allowed bool, reason string) bool {
+	c.mu.RLock()
+	hook := c.auditHook
+	lean := c.Lean
+	c.mu.RUnlock()
+	if hook != nil && !lean {
+		hook(AuditEvent{
+			Time:     c.now(),
+			Username: username,
+			Perm:     perm,
+			Allowed:  allowed,
+			Reason:   reason,
+		})
+	}
+	return allowed
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// auditFileQueueSize is the number of audit events an AuditFile holds while
+// they wait to be written.
+const auditFileQueueSize = 1024
+
+// AuditFile writes audit events to a file, as JSON lines. It is created by
+// SetAuditFile.
+type AuditFile struct {
+	path    string
+	maxSize int64
+
+	f    *os.File
+	w    *bufio.Writer
+	size int64
+	err  error
+
+	ch   chan AuditEvent
+	done chan struct{}
+
+	mu     sync.Mutex // protects closed, and sending on ch
+	closed bool
+
+	dropped int64
+}
+
+// SetAuditFile sets the audit hook to one which appends each event to the file
+// at path as a line of JSON, replacing any hook already set. Events are queued
+// and written by a goroutine of their own, so the hook never waits on the file;
+// if the queue is full, the event is dropped and counted by Dropped. If
+// maxSize is positive, the file is rotated before a line would take it past
+// maxSize bytes, by renaming it to path with ".1" appended, replacing any
+// file of that name, and starting a new file at path. The returned AuditFile
+// must be closed on shutdown, to write out queued events.
+func (c *CredentialsStore) SetAuditFile(path string, maxSize int64) (*AuditFile, error) {
+	a := &AuditFile{
+		path:    path,
+		maxSize: maxSize,
+		ch:      make(chan AuditEvent, auditFileQueueSize),
+		done:    make(chan struct{}),
+	}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	go a.run()
+	c.SetAuditHook(a.hook)
+	return a, nil
+}
+
+// Dropped returns the number of events dropped because the queue was full.
+func (a *AuditFile) Dropped() int64 {
+	return atomic.LoadInt64(&a.dropped)
+}
+
+// Close writes out all queued events and closes the file. Events reported to
+// the hook after Close are dropped. It returns the first error encountered
+// while writing the file, if any.
+func (a *AuditFile) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.ch)
+	}
+	a.mu.Unlock()
+	<-a.done
+	return a.err
+}
+
+// hook queues event to be written, without waiting.
+func (a *AuditFile) hook(event AuditEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		atomic.AddInt64(&a.dropped, 1)
+		return
+	}
+	select {
+	case a.ch <- event:
+	default:
+		atomic.AddInt64(&a.dropped, 1)
+	}
+}
+
+// run writes queued events until the queue is closed, flushing whenever it
+// is empty.
+func (a *AuditFile) run() {
+	defer close(a.done)
+	for event := range a.ch {
+		a.write(event)
+		if len(a.ch) == 0 {
+			a.setErr(a.w.Flush())
+		}
+	}
+	a.setErr(a.w.Flush())
+	a.setErr(a.f.Close())
+}
+
+// write appends event to the file, rotating it first if need be.
+func (a *AuditFile) write(event AuditEvent) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		a.setErr(err)
+		return
+	}
+	b = append(b, '\n')
+	if a.maxSize > 0 && a.size > 0 && a.size+int64(len(b)) > a.maxSize {
+		if err := a.rotate(); err != nil {
+			a.setErr(err)
+			return
+		}
+	}
+	n, err := a.w.Write(b)
+	a.size += int64(n)
+	a.setErr(err)
+}
+
+// open opens the file at path for appending.
+func (a *AuditFile) open() error {
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.f, a.w, a.size = f, bufio.NewWriter(f), fi.Size()
+	return nil
+}
+
+// rotate moves the current file aside, and opens a new one.
+func (a *AuditFile) rotate() error {
+	if err := a.w.Flush(); err != nil {
+		return err
+	}
+	if err := a.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(a.path, a.path+".1"); err != nil {
+		return err
+	}
+	return a.open()
+}
+
+// setErr records err, if it is the first error.
+func (a *AuditFile) setErr(err error) {
+	if a.err == nil {
+		a.err = err
+	}
+}
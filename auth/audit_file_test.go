@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_AuthAuditFile(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1", Perms: []string{PermQuery}}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	path := filepath.Join(t.TempDir(), "audit.log")
+	af, err := store.SetAuditFile(path, 0)
+	if err != nil {
+		t.Fatalf("failed to set audit file: %s", err.Error())
+	}
+
+	store.AA("username1", "password1", PermQuery)
+	store.AA("username1", "password1", PermExecute)
+	store.AA("username1", "wrong", PermQuery)
+	if err := af.Close(); err != nil {
+		t.Fatalf("failed to close audit file: %s", err.Error())
+	}
+	// Events after Close are dropped.
+	store.AA("username1", "password1", PermQuery)
+
+	events := readAuditFile(t, path)
+	if len(events) != 3 {
+		t.Fatalf("wrong number of events, exp 3, got %d", len(events))
+	}
+	exp := []struct {
+		perm    string
+		allowed bool
+		reason  string
+	}{
+		{PermQuery, true, AuditReasonGranted},
+		{PermExecute, false, AuditReasonNotGranted},
+		{PermQuery, false, ErrBadPassword.Error()},
+	}
+	for i, e := range exp {
+		got := events[i]
+		if got.Username != "username1" || got.Perm != e.perm || got.Allowed != e.allowed || got.Reason != e.reason {
+			t.Fatalf("wrong event %d, got %+v", i, got)
+		}
+	}
+	if af.Dropped() != 1 {
+		t.Fatalf("wrong number of dropped events, exp 1, got %d", af.Dropped())
+	}
+}
+
+func Test_AuthAuditFileRotate(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1", Perms: []string{PermQuery}}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	path := filepath.Join(t.TempDir(), "audit.log")
+	af, err := store.SetAuditFile(path, 300)
+	if err != nil {
+		t.Fatalf("failed to set audit file: %s", err.Error())
+	}
+	for i := 0; i < 10; i++ {
+		store.AA("username1", "password1", PermQuery)
+	}
+	if err := af.Close(); err != nil {
+		t.Fatalf("failed to close audit file: %s", err.Error())
+	}
+
+	for _, p := range []string{path, path + ".1"} {
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("failed to stat %s: %s", p, err.Error())
+		}
+		if fi.Size() > 300 {
+			t.Fatalf("%s exceeds max size, size %d", p, fi.Size())
+		}
+		if len(readAuditFile(t, p)) == 0 {
+			t.Fatalf("%s contains no events", p)
+		}
+	}
+}
+
+// readAuditFile returns the events in the audit file at path, failing the test
+// if any line is not a well-formed event.
+func readAuditFile(t *testing.T, path string) []AuditEvent {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open audit file: %s", err.Error())
+	}
+	defer f.Close()
+	var events []AuditEvent
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e AuditEvent
+		dec := json.NewDecoder(bytes.NewReader(sc.Bytes()))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("malformed audit line %q: %s", sc.Text(), err.Error())
+		}
+		events = append(events, e)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("failed to read audit file: %s", err.Error())
+	}
+	return events
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AuditReportExpiryWindow is how soon a credential must expire to be reported
+// in AuditSummary.ExpiringSoon.
+const AuditReportExpiryWindow = 7 * 24 * time.Hour
+
+// AuditSummary lists the users in a store whose credentials need attention,
+// as returned by AuditReport. Each list is of sorted usernames, and a user may
+// appear in more than one.
+type AuditSummary struct {
+	// Plaintext lists users with a password stored in plaintext.
+	Plaintext []string
+
+	// WeakHash lists users with a bcrypt hash of lower cost than RehashCost,
+	// or than bcrypt.DefaultCost if RehashCost is not set. Argon2id hashes
+	// are not judged.
+	WeakHash []string
+
+	// NoPerms lists users who may authenticate, but hold no perms, not even
+	// via AllUsers, including those of their tenant, or AuthedUsers.
+	NoPerms []string
+
+	// ExpiringSoon lists users whose credentials expire within
+	// AuditReportExpiryWindow, as reported by ExpiringSoon.
+	ExpiringSoon []string
+
+	// Expired lists users whose credentials have expired, so who are
+	// disabled.
+	Expired []string
+
+	// LockedOut lists users who are currently locked out.
+	LockedOut []string
+}
+
+// AuditReport returns a summary of the users whose credentials need attention,
+// for example for an operations dashboard. It is taken at a single point in
+// time, under the read lock.
+func (c *CredentialsStore) AuditReport() AuditSummary {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now()
+	minCost := c.RehashCost
+	if minCost == 0 {
+		minCost = bcrypt.DefaultCost
+	}
+	var s AuditSummary
+	for u := range c.store {
+		if u == AllUsers || u == AuthedUsers || c.isGroup(u) {
+			continue
+		}
+		var plaintext, weak bool
+		for _, pw := range c.passwordsOf(u) {
+			switch {
+			case pw == "":
+			case isBcryptHash(pw):
+				if cost, err := bcrypt.Cost([]byte(pw)); err == nil && cost < minCost {
+					weak = true
+				}
+			case !isHashed(pw):
+				plaintext = true
+			}
+		}
+		if plaintext {
+			s.Plaintext = append(s.Plaintext, u)
+		}
+		if weak {
+			s.WeakHash = append(s.WeakHash, u)
+		}
+		if c.permless(u) {
+			s.NoPerms = append(s.NoPerms, u)
+		}
+		if t, ok := c.expires[u]; ok && t.After(now) && !t.After(now.Add(AuditReportExpiryWindow)) {
+			s.ExpiringSoon = append(s.ExpiringSoon, u)
+		}
+		if c.isExpired(u) {
+			s.Expired = append(s.Expired, u)
+		}
+		if c.isLockedOut(u) {
+			s.LockedOut = append(s.LockedOut, u)
+		}
+	}
+	for _, l := range [][]string{s.Plaintext, s.WeakHash, s.NoPerms, s.ExpiringSoon, s.Expired, s.LockedOut} {
+		sort.Strings(l)
+	}
+	return s
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func Test_AuthAuditReport(t *testing.T) {
+	store := NewCredentialsStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	store.SetLockoutPolicy(&LockoutPolicy{MaxFailures: 1, Window: time.Minute, Duration: time.Hour})
+
+	strong := mustBcryptCost(t, "password1", 10)
+	for _, cred := range []Credential{
+		{Username: "good", Password: strong, Perms: []string{PermQuery}},
+		{Username: "plain", Password: "password1", Perms: []string{PermQuery}},
+		{Username: "weak", Password: mustBcrypt(t, "password1"), Perms: []string{PermQuery}},
+		{Username: "permless", Password: strong},
+		{Username: "expiring", Password: strong, Perms: []string{PermQuery}, Expires: now.Add(24 * time.Hour).Format(time.RFC3339)},
+		{Username: "expired", Password: strong, Perms: []string{PermQuery}, Expires: now.Add(-time.Hour).Format(time.RFC3339)},
+		{Username: "locked", Password: strong, Perms: []string{PermQuery}},
+		{Username: "later", Password: strong, Perms: []string{PermQuery}, Expires: now.Add(30 * 24 * time.Hour).Format(time.RFC3339)},
+	} {
+		if err := store.AddUser(cred); err != nil {
+			t.Fatalf("failed to add user %s: %s", cred.Username, err.Error())
+		}
+	}
+	store.Check("locked", "wrong")
+
+	exp := AuditSummary{
+		Plaintext:    []string{"plain"},
+		WeakHash:     []string{"weak"},
+		NoPerms:      []string{"permless"},
+		ExpiringSoon: []string{"expiring"},
+		Expired:      []string{"expired"},
+		LockedOut:    []string{"locked"},
+	}
+	if got := store.AuditReport(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong audit report, exp %+v, got %+v", exp, got)
+	}
+
+	// Perms granted to AuthedUsers are held by every user.
+	if err := store.AddUser(Credential{Username: AuthedUsers, Perms: []string{PermStatus}}); err != nil {
+		t.Fatalf("failed to add AuthedUsers: %s", err.Error())
+	}
+	if got := store.AuditReport().NoPerms; got != nil {
+		t.Fatalf("users without perms reported despite AuthedUsers grant: %v", got)
+	}
+}
+
+func mustBcryptCost(t *testing.T, password string, cost int) string {
+	t.Helper()
+	b, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		t.Fatalf("failed to generate bcrypt hash: %s", err.Error())
+	}
+	return string(b)
+}
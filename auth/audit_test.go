@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_AuthAuditHook(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"perms": ["foo"]
+			},
+			{
+				"username": "*",
+				"perms": ["status"]
+			}
+		]
+	`
+
+	store := NewCredentialsStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	var events []AuditEvent
+	store.SetAuditHook(func(e AuditEvent) {
+		// The hook must be able to call back into the store without deadlock.
+		store.HasPerm(e.Username, e.Perm)
+		events = append(events, e)
+	})
+
+	store.AA("", "", "status")
+	store.AA("", "", "foo")
+	store.AA("username1", "wrong", "foo")
+	store.AA("username1", "password1", "bar")
+	store.AA("username1", "password1", "foo")
+	store.HasPermRequest(&testBasicAuther{ok: false}, "foo")
+	store.HasPermRequest(&testBasicAuther{username: "username1", ok: true}, "foo")
+
+	exp := []AuditEvent{
+		{now, "", "status", true, AuditReasonAllUsers},
+		{now, "", "foo", false, AuditReasonAnonymous},
+		{now, "username1", "foo", false, ErrBadPassword.Error()},
+		{now, "username1", "bar", false, AuditReasonNotGranted},
+		{now, "username1", "foo", true, AuditReasonGranted},
+		{now, "", "foo", false, AuditReasonAnonymous},
+		{now, "username1", "foo", true, AuditReasonGranted},
+	}
+	if len(events) != len(exp) {
+		t.Fatalf("wrong number of audit events, exp %d, got %d: %v", len(exp), len(events), events)
+	}
+	for i := range exp {
+		if events[i] != exp[i] {
+			t.Fatalf("wrong audit event at index %d, exp %+v, got %+v", i, exp[i], events[i])
+		}
+	}
+
+	store.SetAuditHook(nil)
+	store.AA("username1", "password1", "foo")
+	if len(events) != len(exp) {
+		t.Fatalf("audit event recorded after hook removed")
+	}
+}
+
+func Test_AuthAuditHookFinalDecision(t *testing.T) {
+	store := NewCredentialsStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	if err := store.Load(strings.NewReader(`[{"username": "username1", "password": "password1", "perms": ["execute"]}]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	store.SetPermSizeLimit("username1", PermExecute, 100)
+	store.SetLoopbackBypass(PermQuery)
+	var events []AuditEvent
+	store.SetAuditHook(func(e AuditEvent) {
+		events = append(events, e)
+	})
+
+	store.AAWithSize("username1", "password1", PermExecute, 100)
+	store.AAWithSize("username1", "password1", PermExecute, 101)
+	store.CheckFromAddr("127.0.0.1:4001", "", "", PermQuery)
+	store.CheckFromAddr("192.168.0.1:4001", "", "", PermQuery)
+
+	exp := []AuditEvent{
+		{now, "username1", "execute", true, AuditReasonGranted},
+		{now, "username1", "execute", false, AuditReasonSizeLimit},
+		{now, "", "query", true, AuditReasonLoopback},
+		{now, "", "query", false, AuditReasonAnonymous},
+	}
+	if len(events) != len(exp) {
+		t.Fatalf("wrong number of audit events, exp %d, got %d: %v", len(exp), len(events), events)
+	}
+	for i := range exp {
+		if events[i] != exp[i] {
+			t.Fatalf("wrong audit event at index %d, exp %+v, got %+v", i, exp[i], events[i])
+		}
+	}
+}
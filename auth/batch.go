@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"runtime"
+	"sync"
+)
+
+// UserPass is a username and password to be checked by CheckBatch.
+type UserPass struct {
+	User string
+	Pass string
+}
+
+// CheckBatch checks every username and password in creds, as by Check, and
+// returns the results in the same order. Checks are performed concurrently by
+// at most BatchWorkers goroutines, so that the expensive hash computations of
+// a large batch are spread across CPUs without monopolizing them.
+func (c *CredentialsStore) CheckBatch(creds []UserPass) []bool {
+	c.mu.RLock()
+	workers := c.BatchWorkers
+	c.mu.RUnlock()
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(creds))
+
+	results := make([]bool, len(creds))
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range idx {
+				results[j] = c.Check(creds[j].User, creds[j].Pass)
+			}
+		}()
+	}
+	for i := range creds {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+	return results
+}
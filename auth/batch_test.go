@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_AuthCheckBatch(t *testing.T) {
+	store := NewCredentialsStore()
+	store.BatchWorkers = 2
+	hash := mustBcrypt(t, "password1")
+	for i := 0; i < 4; i++ {
+		if err := store.AddUser(Credential{Username: fmt.Sprintf("username%d", i), Password: hash}); err != nil {
+			t.Fatalf("failed to add user: %s", err.Error())
+		}
+	}
+
+	var creds []UserPass
+	var exp []bool
+	for i := 0; i < 6; i++ {
+		pw := "password1"
+		if i%2 == 1 {
+			pw = "wrong"
+		}
+		creds = append(creds, UserPass{User: fmt.Sprintf("username%d", i), Pass: pw})
+		exp = append(exp, i < 4 && i%2 == 0)
+	}
+	got := store.CheckBatch(creds)
+	if len(got) != len(exp) {
+		t.Fatalf("wrong number of results, exp %d, got %d", len(exp), len(got))
+	}
+	for i := range exp {
+		if exp[i] != got[i] {
+			t.Fatalf("wrong result for %s at index %d, exp %v, got %v", creds[i].User, i, exp[i], got[i])
+		}
+	}
+	if exp, got := int64(len(creds)), store.Stats().Checks; exp != got {
+		t.Fatalf("wrong number of checks, exp %d, got %d", exp, got)
+	}
+}
+
+func Test_AuthCheckBatchEmpty(t *testing.T) {
+	store := NewCredentialsStore()
+	if got := store.CheckBatch(nil); len(got) != 0 {
+		t.Fatalf("expected no results for empty batch, got %v", got)
+	}
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	binaryMagic   = "RQAU"
+	binaryVersion = 5
+
+	// maxBinaryStringLen is the longest string LoadBinary will accept, guarding
+	// against huge allocations when reading corrupt data.
+	maxBinaryStringLen = 1 << 20
+)
+
+// ErrBadBinaryFormat is returned when data read by LoadBinary is not in the
+// expected format.
+var ErrBadBinaryFormat = errors.New("bad binary credentials format")
+
+// SaveBinary writes the credentials in the store to w in a compact, versioned
+// binary format, which can be read back with LoadBinary. It is much faster to
+// load than JSON for very large credential sets.
+//
+// The format is a magic string and version byte, followed by a table of every
+// distinct perm, and then every user as a username, password, list of indices
+// into the perm table, tenant, list of further passwords, list of indices of
+// denied perms, and RFC3339 expiry, empty if none. All integers are uvarints,
+// all strings are prefixed with their length as a uvarint, and all lists with
+// their number of elements. Data of earlier versions, which lack the later
+// fields, can still be loaded.
+func (c *CredentialsStore) SaveBinary(w io.Writer) error {
+	creds := c.credentials()
+
+	permIdx := make(map[string]uint64)
+	var permTable []string
+	for _, cred := range creds {
+		for _, perms := range [][]string{cred.Perms, cred.Deny} {
+			for _, p := range perms {
+				if _, ok := permIdx[p]; !ok {
+					permIdx[p] = uint64(len(permTable))
+					permTable = append(permTable, p)
+				}
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	var buf []byte
+	buf = append(buf, binaryMagic...)
+	buf = append(buf, binaryVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(permTable)))
+	for _, p := range permTable {
+		buf = appendBinaryString(buf, p)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(creds)))
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+
+	for _, cred := range creds {
+		buf = buf[:0]
+		buf = appendBinaryString(buf, cred.Username)
+		buf = appendBinaryString(buf, cred.Password)
+		buf = binary.AppendUvarint(buf, uint64(len(cred.Perms)))
+		for _, p := range cred.Perms {
+			buf = binary.AppendUvarint(buf, permIdx[p])
+		}
+		buf = appendBinaryString(buf, cred.Tenant)
+		buf = binary.AppendUvarint(buf, uint64(len(cred.Passwords)))
+		for _, pw := range cred.Passwords {
+			buf = appendBinaryString(buf, pw)
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(cred.Deny)))
+		for _, p := range cred.Deny {
+			buf = binary.AppendUvarint(buf, permIdx[p])
+		}
+		buf = appendBinaryString(buf, cred.Expires)
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// LoadBinary loads credential information written by SaveBinary from a reader.
+// The credentials are checked and added as by Load, so data which could not
+// have been loaded as JSON is rejected, and the store is left unchanged.
+func (c *CredentialsStore) LoadBinary(r io.Reader) error {
+	br := bufio.NewReader(r)
+
+	hdr := make([]byte, len(binaryMagic)+1)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return err
+	}
+	if string(hdr[:len(binaryMagic)]) != binaryMagic {
+		return ErrBadBinaryFormat
+	}
+	version := hdr[len(binaryMagic)]
+	if version < 1 || version > binaryVersion {
+		return fmt.Errorf("unsupported binary credentials version %d", version)
+	}
+
+	nPerms, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+	permTable := make([]string, 0, min(nPerms, 1024))
+	for i := uint64(0); i < nPerms; i++ {
+		p, err := readBinaryString(br)
+		if err != nil {
+			return err
+		}
+		permTable = append(permTable, p)
+	}
+
+	nCreds, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+	creds := make([]Credential, 0, min(nCreds, 1024))
+	for i := uint64(0); i < nCreds; i++ {
+		username, err := readBinaryString(br)
+		if err != nil {
+			return err
+		}
+		password, err := readBinaryString(br)
+		if err != nil {
+			return err
+		}
+		cred := Credential{
+			Username: username,
+			Password: password,
+		}
+		if cred.Perms, err = readBinaryPerms(br, permTable); err != nil {
+			return err
+		}
+		if version >= 2 {
+			if cred.Tenant, err = readBinaryString(br); err != nil {
+				return err
+			}
+		}
+		if version >= 3 {
+			n, err := binary.ReadUvarint(br)
+			if err != nil {
+				return err
+			}
+			for j := uint64(0); j < n; j++ {
+				pw, err := readBinaryString(br)
+				if err != nil {
+					return err
+				}
+				cred.Passwords = append(cred.Passwords, pw)
+			}
+		}
+		if version >= 4 {
+			if cred.Deny, err = readBinaryPerms(br, permTable); err != nil {
+				return err
+			}
+		}
+		if version >= 5 {
+			if cred.Expires, err = readBinaryString(br); err != nil {
+				return err
+			}
+			if _, err := parseExpires(cred.Expires); err != nil {
+				return ErrBadBinaryFormat
+			}
+		}
+		creds = append(creds, cred)
+	}
+	return c.load(creds)
+}
+
+// readBinaryPerms reads a list of indices into permTable, returning the perms.
+func readBinaryPerms(br *bufio.Reader, permTable []string) ([]string, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	perms := make([]string, 0, min(n, uint64(len(permTable))))
+	for j := uint64(0); j < n; j++ {
+		idx, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if idx >= uint64(len(permTable)) {
+			return nil, ErrBadBinaryFormat
+		}
+		perms = append(perms, permTable[idx])
+	}
+	return perms, nil
+}
+
+func appendBinaryString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func readBinaryString(br *bufio.Reader) (string, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return "", err
+	}
+	if n > maxBinaryStringLen {
+		return "", ErrBadBinaryFormat
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(br, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
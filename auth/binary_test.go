@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_BinaryRoundTrip(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"perms": ["foo", "bar"]
+			},
+			{
+				"username": "username2",
+				"password": "$2a$10$fKRHxrEuyDTP6tXIiDycr.nyC8Q7UMIfc31YMyXHDLgRDyhLK3VFS",
+				"perms": ["bar"]
+			},
+			{
+				"username": "username3",
+				"password": "password3"
+			},
+			{
+				"username": "username4",
+				"password": "password4",
+				"perms": ["foo"],
+				"tenant": "tenant1",
+				"expires": "2099-12-31T23:59:59Z"
+			},
+			{
+				"username": "username5",
+				"password": "password5",
+				"passwords": ["password6", "password7"],
+				"perms": ["all"],
+				"deny": ["remove"]
+			},
+			{
+				"username": "*",
+				"perms": ["qux"]
+			},
+			{
+				"username": "*",
+				"perms": ["foo"],
+				"tenant": "tenant1"
+			}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	var buf bytes.Buffer
+	if err := store.SaveBinary(&buf); err != nil {
+		t.Fatalf("failed to save binary credentials: %s", err.Error())
+	}
+
+	loaded := NewCredentialsStore()
+	if err := loaded.LoadBinary(&buf); err != nil {
+		t.Fatalf("failed to load binary credentials: %s", err.Error())
+	}
+	if !reflect.DeepEqual(store.credentials(), loaded.credentials()) {
+		t.Fatalf("binary round trip mismatch, exp %v, got %v", store.credentials(), loaded.credentials())
+	}
+	if !loaded.Check("username1", "password1") {
+		t.Fatalf("username1 credential not loaded correctly")
+	}
+	if !loaded.Check("username5", "password7") {
+		t.Fatalf("username5 further passwords not loaded correctly")
+	}
+	if loaded.AA("username5", "password5", PermRemove) {
+		t.Fatalf("username5 denied perm not loaded correctly")
+	}
+	if !loaded.HasPerm("username3", "qux") {
+		t.Fatalf("username3 should have qux perm via *")
+	}
+}
+
+func Test_BinaryLoadVersion1(t *testing.T) {
+	// One perm "a", one user "u" with password "p" and perm index 0.
+	store := NewCredentialsStore()
+	if err := store.LoadBinary(strings.NewReader("RQAU\x01\x01\x01a\x01\x01u\x01p\x01\x00")); err != nil {
+		t.Fatalf("failed to load version 1 binary credentials: %s", err.Error())
+	}
+	if !store.Check("u", "p") || !store.HasPerm("u", "a") {
+		t.Fatalf("version 1 credential not loaded correctly")
+	}
+}
+
+func Test_BinaryLoadVersion2(t *testing.T) {
+	// One perm "a", one user "u" with password "p", perm index 0, tenant "t".
+	store := NewCredentialsStore()
+	if err := store.LoadBinary(strings.NewReader("RQAU\x02\x01\x01a\x01\x01u\x01p\x01\x00\x01t")); err != nil {
+		t.Fatalf("failed to load version 2 binary credentials: %s", err.Error())
+	}
+	if !store.Check("u", "p") || !store.HasTenantPerm("t", "u", "a") {
+		t.Fatalf("version 2 credential not loaded correctly")
+	}
+}
+
+func Test_BinaryLoadBad(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.LoadBinary(strings.NewReader("")); err == nil {
+		t.Fatalf("expected error loading empty input")
+	}
+	if err := store.LoadBinary(strings.NewReader("XXXX\x01")); err != ErrBadBinaryFormat {
+		t.Fatalf("expected ErrBadBinaryFormat for bad magic, got %v", err)
+	}
+	if err := store.LoadBinary(strings.NewReader("RQAU\x06")); err == nil {
+		t.Fatalf("expected error for unsupported version")
+	}
+
+	// One perm "a", one user "u" with empty password referencing perm index 1.
+	if err := store.LoadBinary(strings.NewReader("RQAU\x01\x01\x01a\x01\x01u\x00\x01\x01")); err != ErrBadBinaryFormat {
+		t.Fatalf("expected ErrBadBinaryFormat for out of range perm index, got %v", err)
+	}
+
+	// Truncated user record.
+	if err := store.LoadBinary(strings.NewReader("RQAU\x01\x00\x01\x05ab")); err == nil {
+		t.Fatalf("expected error for truncated input")
+	}
+}
+
+func Test_BinaryLoadRejected(t *testing.T) {
+	hash := mustBcrypt(t, "password1")
+	costly := hash[:4] + "31" + hash[6:]
+	for _, tt := range []struct {
+		cred Credential
+		err  string
+	}{
+		{Credential{Username: "ev:il", Password: "password1"}, "contains a colon"},
+		{Credential{Username: "username1", Password: "password1", Perms: []string{"nosuchperm"}}, `unknown perm "nosuchperm"`},
+		{Credential{Username: "username1", Password: costly}, "exceeding maximum of 15"},
+		{Credential{Username: "username1"}, `empty password for user "username1"`},
+	} {
+		// Credentials like these cannot be loaded, so are put in the store
+		// directly.
+		src := NewCredentialsStore()
+		src.putCredential(tt.cred)
+		var buf bytes.Buffer
+		if err := src.SaveBinary(&buf); err != nil {
+			t.Fatalf("failed to save binary: %s", err.Error())
+		}
+
+		store := NewCredentialsStore()
+		store.StrictPerms = true
+		store.ValidateOnLoad = true
+		err := store.LoadBinary(&buf)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("wrong error loading %v, exp %q, got %v", tt.cred, tt.err, err)
+		}
+		if len(store.Users()) != 0 {
+			t.Fatalf("store modified by rejected binary credentials %v", tt.cred)
+		}
+	}
+
+	// Two users "u", with passwords "p" and "q".
+	store := NewCredentialsStore()
+	err := store.LoadBinary(strings.NewReader("RQAU\x01\x00\x02\x01u\x01p\x00\x01u\x01q\x00"))
+	if err == nil || !strings.Contains(err.Error(), `duplicate username "u"`) {
+		t.Fatalf("wrong error loading duplicate users, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+// ErrUserNotFound is returned when an operation refers to a user which is
+// not in the store.
+var ErrUserNotFound = errors.New("user not found")
+
+// builtinPerms are the perms understood by rqlite itself. PermAll is expanded
+// into these perms when reporting a user's effective perms.
+var builtinPerms = []string{
+	PermJoin,
+	PermJoinReadOnly,
+	PermRemove,
+	PermExecute,
+	PermQuery,
+	PermStatus,
+	PermReady,
+	PermBackup,
+	PermLoad,
+}
+
+// capabilities is the document returned by CapabilitiesJSON.
+type capabilities struct {
+	Username string   `json:"username"`
+	Tenant   string   `json:"tenant,omitempty"`
+	Perms    []string `json:"perms"`
+}
+
+// CapabilitiesJSON returns a JSON document describing what username may do,
+// suitable for returning to a client once it has authenticated. The document
+// lists the user's effective perms, including those granted via AllUsers and,
+// as the client has authenticated, AuthedUsers, with PermAll expanded into the
+// individual built-in perms. It never contains the
+// user's password. ErrUserNotFound is returned if username is not in the store.
+func (c *CredentialsStore) CapabilitiesJSON(username string) ([]byte, error) {
+	c.mu.RLock()
+	username = c.normalize(username)
+	if _, ok := c.store[username]; !ok {
+		c.mu.RUnlock()
+		return nil, ErrUserNotFound
+	}
+	tenant := c.tenants[username]
+	effective := c.authedEffectivePerms(username)
+	if effective[PermAll] {
+		for _, p := range builtinPerms {
+			if !c.isDenied(username, p) {
+				effective[p] = true
+			}
+		}
+	}
+	c.mu.RUnlock()
+
+	perms := make([]string, 0, len(effective))
+	for p := range effective {
+		perms = append(perms, p)
+	}
+	sort.Strings(perms)
+
+	return json.Marshal(capabilities{
+		Username: username,
+		Tenant:   tenant,
+		Perms:    perms,
+	})
+}
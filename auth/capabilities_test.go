@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_CapabilitiesJSON(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username1", "password": "password1", "perms": ["query", "foo"]},
+			{"username": "username2", "password": "password2", "perms": ["all"]},
+			{"username": "username3", "password": "password3", "perms": ["query"], "tenant": "a"},
+			{"username": "*", "perms": ["status"]},
+			{"username": "*", "perms": ["ready"], "tenant": "a"},
+			{"username": "+", "perms": ["backup", "load"]},
+			{"username": "username4", "password": "password4", "deny": ["load"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	for _, tt := range []struct {
+		username string
+		exp      string
+	}{
+		{
+			username: "username1",
+			exp:      `{"username":"username1","perms":["backup","foo","load","query","status"]}`,
+		},
+		{
+			username: "username2",
+			exp:      `{"username":"username2","perms":["all","backup","execute","join","join-read-only","load","query","ready","remove","status"]}`,
+		},
+		{
+			username: "username3",
+			// As for HasPerm, only the AllUsers grants with no tenant apply.
+			exp: `{"username":"username3","tenant":"a","perms":["backup","load","query","status"]}`,
+		},
+		{
+			username: "username4",
+			// AuthedUsers grants are subject to the user's denials.
+			exp: `{"username":"username4","perms":["backup","status"]}`,
+		},
+	} {
+		b, err := store.CapabilitiesJSON(tt.username)
+		if err != nil {
+			t.Fatalf("failed to get capabilities for %s: %s", tt.username, err.Error())
+		}
+		if string(b) != tt.exp {
+			t.Fatalf("wrong capabilities for %s, exp %s, got %s", tt.username, tt.exp, string(b))
+		}
+		if strings.Contains(string(b), "password") {
+			t.Fatalf("capabilities for %s contain password", tt.username)
+		}
+	}
+
+	if _, err := store.CapabilitiesJSON("nonexistent"); err != ErrUserNotFound {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNoCapabilitySecret is returned when a capability token is requested but
+// no secret has been set.
+var ErrNoCapabilitySecret = errors.New("no capability secret set")
+
+// capability is the payload of a capability token.
+type capability struct {
+	Username string `json:"u"`
+	Perm     string `json:"p"`
+	Expiry   int64  `json:"e"`
+}
+
+// SetCapabilitySecret sets the secret used to sign and verify capability tokens.
+// Any previous secrets retained by RotateSecret are discarded.
+func (c *CredentialsStore) SetCapabilitySecret(secret []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.capabilitySecret = append([]byte(nil), secret...)
+	c.previousSecrets = nil
+}
+
+// RotateSecret makes newPrimary the secret used to sign capability tokens. The
+// old primary secret is retained, as previous secret 0, so that tokens signed
+// with it continue to verify until it is removed by ExpirePreviousSecret.
+func (c *CredentialsStore) RotateSecret(newPrimary []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.capabilitySecret) != 0 {
+		c.previousSecrets = append([][]byte{c.capabilitySecret}, c.previousSecrets...)
+	}
+	c.capabilitySecret = append([]byte(nil), newPrimary...)
+}
+
+// ExpirePreviousSecret removes the previous secret at index, where 0 is the
+// most recently replaced secret. Tokens signed with it no longer verify.
+func (c *CredentialsStore) ExpirePreviousSecret(index int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if index < 0 || index >= len(c.previousSecrets) {
+		return fmt.Errorf("no previous secret at index %d", index)
+	}
+	c.previousSecrets = append(c.previousSecrets[:index:index], c.previousSecrets[index+1:]...)
+	return nil
+}
+
+// MintCapabilityToken returns a token granting username the single perm until
+// expiry, independent of the perms username holds in the store. The token is
+// signed with the secret set via SetCapabilitySecret.
+func (c *CredentialsStore) MintCapabilityToken(username, perm string, expiry time.Time) (string, error) {
+	c.mu.RLock()
+	secret := c.capabilitySecret
+	c.mu.RUnlock()
+	if len(secret) == 0 {
+		return "", ErrNoCapabilitySecret
+	}
+	b, err := json.Marshal(capability{
+		Username: username,
+		Perm:     perm,
+		Expiry:   expiry.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	sig := base64.RawURLEncoding.EncodeToString(signCapability(secret, payload))
+	return payload + "." + sig, nil
+}
+
+// CheckCapabilityToken verifies token, and returns the username it was minted
+// for if the token's signature is valid, it grants perm, and it has not expired.
+// The signature is checked against the primary secret first, and then against
+// any previous secrets retained by RotateSecret.
+func (c *CredentialsStore) CheckCapabilityToken(token, perm string) (string, bool) {
+	c.mu.RLock()
+	secrets := make([][]byte, 0, len(c.previousSecrets)+1)
+	if len(c.capabilitySecret) != 0 {
+		secrets = append(secrets, c.capabilitySecret)
+	}
+	secrets = append(secrets, c.previousSecrets...)
+	c.mu.RUnlock()
+	if len(secrets) == 0 {
+		return "", false
+	}
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return "", false
+	}
+	if !verifyCapability(secrets, payload, mac) {
+		return "", false
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", false
+	}
+	var cp capability
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return "", false
+	}
+	if cp.Perm != perm || !c.now().Before(time.Unix(cp.Expiry, 0)) {
+		return "", false
+	}
+	return cp.Username, true
+}
+
+func verifyCapability(secrets [][]byte, payload string, mac []byte) bool {
+	for _, secret := range secrets {
+		if hmac.Equal(mac, signCapability(secret, payload)) {
+			return true
+		}
+	}
+	return false
+}
+
+func signCapability(secret []byte, payload string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
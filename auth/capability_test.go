@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_CapabilityTokenNoSecret(t *testing.T) {
+	store := NewCredentialsStore()
+	if _, err := store.MintCapabilityToken("username1", PermQuery, time.Now().Add(time.Minute)); err != ErrNoCapabilitySecret {
+		t.Fatalf("expected ErrNoCapabilitySecret, got %v", err)
+	}
+	if _, ok := store.CheckCapabilityToken("foo.bar", PermQuery); ok {
+		t.Fatalf("token verified with no secret set")
+	}
+}
+
+func Test_CapabilityToken(t *testing.T) {
+	store := NewCredentialsStore()
+	store.SetCapabilitySecret([]byte("secret1"))
+
+	token, err := store.MintCapabilityToken("username1", PermBackup, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to mint token: %s", err.Error())
+	}
+
+	username, ok := store.CheckCapabilityToken(token, PermBackup)
+	if !ok {
+		t.Fatalf("valid token not verified")
+	}
+	if username != "username1" {
+		t.Fatalf("wrong username returned, exp username1, got %s", username)
+	}
+
+	// Mismatched perm.
+	if _, ok := store.CheckCapabilityToken(token, PermRemove); ok {
+		t.Fatalf("token verified for wrong perm")
+	}
+
+	// Expired token.
+	expired, err := store.MintCapabilityToken("username1", PermBackup, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("failed to mint token: %s", err.Error())
+	}
+	if _, ok := store.CheckCapabilityToken(expired, PermBackup); ok {
+		t.Fatalf("expired token verified")
+	}
+
+	// Tampered payload.
+	payload, sig, _ := strings.Cut(token, ".")
+	other, err := store.MintCapabilityToken("username2", PermBackup, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to mint token: %s", err.Error())
+	}
+	otherPayload, _, _ := strings.Cut(other, ".")
+	if _, ok := store.CheckCapabilityToken(otherPayload+"."+sig, PermBackup); ok {
+		t.Fatalf("token with tampered payload verified")
+	}
+
+	// Tampered signature.
+	if _, ok := store.CheckCapabilityToken(payload+".AAAA", PermBackup); ok {
+		t.Fatalf("token with tampered signature verified")
+	}
+
+	// Malformed tokens.
+	for _, tok := range []string{"", "nodot", ".", payload + "."} {
+		if _, ok := store.CheckCapabilityToken(tok, PermBackup); ok {
+			t.Fatalf("malformed token %q verified", tok)
+		}
+	}
+
+	// Different secret.
+	store.SetCapabilitySecret([]byte("secret2"))
+	if _, ok := store.CheckCapabilityToken(token, PermBackup); ok {
+		t.Fatalf("token verified with different secret")
+	}
+}
+
+func Test_CapabilityTokenRotateSecret(t *testing.T) {
+	store := NewCredentialsStore()
+	store.SetCapabilitySecret([]byte("secret1"))
+
+	token1, err := store.MintCapabilityToken("username1", PermQuery, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to mint token: %s", err.Error())
+	}
+
+	store.RotateSecret([]byte("secret2"))
+	token2, err := store.MintCapabilityToken("username2", PermQuery, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to mint token: %s", err.Error())
+	}
+	store.RotateSecret([]byte("secret3"))
+	token3, err := store.MintCapabilityToken("username3", PermQuery, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to mint token: %s", err.Error())
+	}
+
+	// All tokens verify during the overlap.
+	for i, tok := range []string{token1, token2, token3} {
+		if _, ok := store.CheckCapabilityToken(tok, PermQuery); !ok {
+			t.Fatalf("token %d not verified during overlap", i+1)
+		}
+	}
+
+	// Previous secret 1 is secret1, previous secret 0 is secret2.
+	if err := store.ExpirePreviousSecret(1); err != nil {
+		t.Fatalf("failed to expire previous secret: %s", err.Error())
+	}
+	if _, ok := store.CheckCapabilityToken(token1, PermQuery); ok {
+		t.Fatalf("token signed with expired secret verified")
+	}
+	if _, ok := store.CheckCapabilityToken(token2, PermQuery); !ok {
+		t.Fatalf("token signed with retained secret not verified")
+	}
+
+	if err := store.ExpirePreviousSecret(0); err != nil {
+		t.Fatalf("failed to expire previous secret: %s", err.Error())
+	}
+	if _, ok := store.CheckCapabilityToken(token2, PermQuery); ok {
+		t.Fatalf("token signed with expired secret verified")
+	}
+	if username, ok := store.CheckCapabilityToken(token3, PermQuery); !ok || username != "username3" {
+		t.Fatalf("token signed with primary secret not verified")
+	}
+
+	if err := store.ExpirePreviousSecret(0); err == nil {
+		t.Fatalf("expected error expiring nonexistent previous secret")
+	}
+}
+
+func Test_CapabilityTokenClock(t *testing.T) {
+	store := NewCredentialsStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	store.SetCapabilitySecret([]byte("secret1"))
+
+	token, err := store.MintCapabilityToken("username1", PermBackup, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to mint token: %s", err.Error())
+	}
+	if _, ok := store.CheckCapabilityToken(token, PermBackup); !ok {
+		t.Fatalf("valid token not verified")
+	}
+	now = now.Add(time.Minute)
+	if _, ok := store.CheckCapabilityToken(token, PermBackup); ok {
+		t.Fatalf("token verified at expiry")
+	}
+}
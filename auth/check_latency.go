@@ -0,0 +1,37 @@
+package auth
+
+import "time"
+
+const (
+	// CheckPathCacheHit is the path of a check whose password was verified,
+	// or rejected, from a hash cache, avoiding a hash computation.
+	CheckPathCacheHit = "cache_hit"
+
+	// CheckPathHash is the path of a check which computed a hash, such as via
+	// bcrypt, to verify its password.
+	CheckPathHash = "hash"
+
+	// CheckPathPlaintext is the path of a check needing neither, such as one
+	// of a plaintext password or an unknown user.
+	CheckPathPlaintext = "plaintext"
+)
+
+// CheckLatencyHook is a function which observes how long a check took to
+// verify a password, and the path it took, one of CheckPathCacheHit,
+// CheckPathHash and CheckPathPlaintext. It is typically used to feed a
+// histogram, such as a Prometheus HistogramVec labelled by path.
+type CheckLatencyHook func(path string, d time.Duration)
+
+// SetCheckLatencyHook sets the hook called with the latency of every password
+// verification made by Check, AA and their variants, so that, for example,
+// hash latency can be tracked separately from that of cache hits. A check of
+// a user with several passwords reports the most expensive path taken, and
+// one denied by lockout before its password is verified is not reported. The
+// hook is called synchronously, without the store's lock held, and not at all
+// for dry runs or while the store is Lean. Passing nil removes the hook, which
+// is the default.
+func (c *CredentialsStore) SetCheckLatencyHook(hook CheckLatencyHook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkLatencyHook = hook
+}
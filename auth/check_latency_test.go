@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_CheckLatencyHook(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.AddUser(Credential{Username: "username1", Password: mustBcrypt(t, "password1"), Perms: []string{PermQuery}}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	if err := store.AddUser(Credential{Username: "username2", Password: "password2"}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	var paths []string
+	store.SetCheckLatencyHook(func(path string, d time.Duration) {
+		if d < 0 {
+			t.Errorf("negative latency %s", d)
+		}
+		paths = append(paths, path)
+	})
+
+	store.Check("username1", "password1") // Hash computed.
+	store.Check("username1", "password1") // Cache hit.
+	store.AA("username1", "password1", PermQuery)
+	store.Check("username2", "password2")
+	store.Check("nobody", "password1")
+	store.AADryRun("username1", "password1", PermQuery)
+	exp := []string{CheckPathHash, CheckPathCacheHit, CheckPathCacheHit, CheckPathPlaintext, CheckPathPlaintext}
+	if !reflect.DeepEqual(exp, paths) {
+		t.Fatalf("wrong paths observed, exp %v, got %v", exp, paths)
+	}
+
+	// A rejection from the negative cache is a cache hit.
+	store.SetNegativeHashCache(NewHashCache())
+	paths = nil
+	store.Check("username1", "wrong")
+	store.Check("username1", "wrong")
+	exp = []string{CheckPathHash, CheckPathCacheHit}
+	if !reflect.DeepEqual(exp, paths) {
+		t.Fatalf("wrong paths observed for wrong password, exp %v, got %v", exp, paths)
+	}
+
+	// Nothing is observed while lean, or once the hook is removed.
+	paths = nil
+	store.Lean = true
+	store.Check("username1", "password1")
+	store.Lean = false
+	store.SetCheckLatencyHook(nil)
+	store.Check("username1", "password1")
+	if len(paths) != 0 {
+		t.Fatalf("paths observed while lean or without hook: %v", paths)
+	}
+}
@@ -3,9 +3,23 @@
 package auth
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
@@ -13,6 +27,11 @@ const (
 	// any BasicAuth information).
 	AllUsers = "*"
 
+	// AuthedUsers is the username that indicates all authenticated users. Unlike
+	// perms granted to AllUsers, perms granted to AuthedUsers are only held by
+	// requests with valid credentials, and only when checked by AA.
+	AuthedUsers = "+"
+
 	// PermAll means all actions permitted.
 	PermAll = "all"
 	// PermJoin means user is permitted to join cluster.
@@ -35,6 +54,37 @@ const (
 	PermLoad = "load"
 )
 
+// DefaultMaxBcryptCost is the default value of MaxBcryptCost.
+const DefaultMaxBcryptCost = 15
+
+// ErrDeniedByGate is returned when the auth gate denies a user who supplied
+// the correct password.
+var ErrDeniedByGate = errors.New("denied by auth gate")
+
+// ErrExpired is returned when a user who supplied the correct password has a
+// credential which has expired.
+var ErrExpired = errors.New("credential expired")
+
+// ErrStaleAuth describes why AA denied a user who supplied the correct
+// password a perm set via SetRecentAuthRequirement: the user last explicitly
+// authenticated too long ago. It is the reason reported to the audit hook.
+var ErrStaleAuth = errors.New("authentication too old for perm")
+
+// ErrNoCredentials is returned when RequireNonEmpty is set and a document
+// containing no credentials is loaded.
+var ErrNoCredentials = errors.New("no credentials loaded")
+
+// ErrRequestTooLarge is returned by AAWithSize when a request is denied only
+// because it exceeds the size limit set via SetPermSizeLimit.
+var ErrRequestTooLarge = errors.New(AuditReasonSizeLimit)
+
+// errAnonymous and errNotGranted are returned by aa when a request is denied
+// for lack of a username, or for lack of the perm, respectively.
+var (
+	errAnonymous  = errors.New(AuditReasonAnonymous)
+	errNotGranted = errors.New(AuditReasonNotGranted)
+)
+
 // BasicAuther is the interface an object must support to return basic auth information.
 type BasicAuther interface {
 	BasicAuth() (string, string, bool)
@@ -42,27 +92,252 @@ type BasicAuther interface {
 
 // Credential represents authentication and authorization configuration for a single user.
 type Credential struct {
-	Username string   `json:"username,omitempty"`
-	Password string   `json:"password,omitempty"`
-	Perms    []string `json:"perms,omitempty"`
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	// Passwords are further passwords of the user, any of which, as well as
+	// Password, authenticates the user. This allows a password to be rotated
+	// without downtime, by listing both the old and new passwords until every
+	// client has switched to the new one.
+	Passwords []string `json:"passwords,omitempty" yaml:"passwords,omitempty"`
+	Perms     []string `json:"perms,omitempty" yaml:"perms,omitempty"`
+	Tenant    string   `json:"tenant,omitempty" yaml:"tenant,omitempty"`
+	Roles     []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	// Deny lists perms the user never has, even if they are granted directly,
+	// via a role, via PermAll, or via AllUsers. Denials are not inherited from
+	// AllUsers.
+	Deny []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+	// Expires is the time, in RFC3339 format, after which the user can no
+	// longer authenticate. If empty, the credential never expires.
+	Expires string `json:"expires,omitempty" yaml:"expires,omitempty"`
+}
+
+// UnmarshalJSON unmarshals a Credential, accepting its perms either as an array
+// of strings or as a single comma-separated string, such as "query, status".
+func (c *Credential) UnmarshalJSON(b []byte) error {
+	var aux struct {
+		rawCredential
+		Perms json.RawMessage `json:"perms,omitempty"`
+	}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	var perms []string
+	if len(aux.Perms) > 0 && aux.Perms[0] == '"' {
+		var s string
+		if err := json.Unmarshal(aux.Perms, &s); err != nil {
+			return err
+		}
+		for _, p := range strings.Split(s, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				perms = append(perms, p)
+			}
+		}
+	} else if len(aux.Perms) > 0 {
+		if err := json.Unmarshal(aux.Perms, &perms); err != nil {
+			return err
+		}
+	}
+
+	*c = Credential(aux.rawCredential)
+	c.Perms = perms
+	return nil
 }
 
 // CredentialsStore stores authentication and authorization information for all users.
 type CredentialsStore struct {
+	stats Stats // First, for 64-bit alignment of its counters.
+
+	mu    sync.RWMutex
 	store map[string]string
-	perms map[string]map[string]bool
+	perms map[string]PermSet
+
+	// passwords holds every password of users with more than one, the first
+	// of which is also in store.
+	passwords map[string][]string
+
+	denies         map[string]PermSet
+	tenants        map[string]string
+	tenantAllUsers map[string]PermSet
+	expires        map[string]time.Time
+
+	// effective holds each user's perms merged with those of AllUsers, if
+	// eager perms are enabled, and is nil otherwise.
+	effective map[string]PermSet
+
+	hashCache    *HashCache
+	negHashCache *HashCache
+
+	roles map[string][]string
+
+	// rolePerms maps each username to the perms it holds only via a role, each
+	// mapped to the first of its roles which grants it.
+	rolePerms map[string]map[string]string
+
+	implies   map[string][]string
+	impliedBy map[string][]string
+
+	loopbackPerms map[string]bool
+
+	capabilitySecret []byte
+	previousSecrets  [][]byte
+
+	authGate    func(username string) bool
+	verifier    Verifier
+	hashingPool *HashingPool
+
+	sizeLimits   map[string]map[string]int
+	gracePeriods map[string]time.Time
+	recentAuth   map[string]time.Duration
+
+	lockout  *LockoutPolicy
+	failures map[string]*failureRecord
+
+	failureRate atomic.Pointer[failureRate]
+	lastLogins  lastLogins
+
+	groupResolver GroupResolver
+	groups        *groupCache
+
+	reloadCallback      func(path string, err error)
+	sourceErrorCallback func(err error)
+	warningHook         func(msg string)
+	auditHook           AuditHook
+	checkLatencyHook    CheckLatencyHook
+
+	now func() time.Time
+
+	// UseCache indicates whether successful verifications of hashed passwords
+	// should be cached, avoiding repeated expensive hash computations.
+	UseCache bool
+
+	// Lean causes Check, AA and their variants to skip optional
+	// instrumentation, taking the shortest path: Stats are not counted, the
+	// audit and check latency hooks are not called, and only the explicit
+	// logins needed by SetRecentAuthRequirement are recorded, so LastLogin
+	// reports only those. Lockout, the failure rate and the hash caches work
+	// as usual.
+	Lean bool
+
+	// AllowEmptyPassword allows users with an empty password to authenticate,
+	// by supplying an empty password. If false, the default, such users can
+	// never authenticate.
+	AllowEmptyPassword bool
+
+	// EmptyPasswordMatchesAny, if AllowEmptyPassword is set, allows users with
+	// an empty password to authenticate by supplying any password.
+	EmptyPasswordMatchesAny bool
+
+	// StrictPerms causes credentials to be rejected when loaded if they grant
+	// any perm not in KnownPerms, catching misspelled perms. It also causes a
+	// warning to be passed to the warning hook for each user loaded who holds
+	// no perms at all, not even via AllUsers or AuthedUsers, as such a user can
+	// authenticate but do nothing. It is off by default, as some deployments
+	// use perms of their own.
+	StrictPerms bool
+
+	// ValidateOnLoad causes credentials to be rejected when loaded if they
+	// have no password, or a password which begins like a bcrypt or Argon2id
+	// hash but is not a valid one, for example because it was truncated or
+	// has out of range parameters. AllUsers needs no password, and is exempt.
+	ValidateOnLoad bool
+
+	// MergeLastWins causes Merge to replace a user already in the store with
+	// the user of the same name from the other store, rather than fail.
+	MergeLastWins bool
+
+	// RehashCost, if set, is the bcrypt cost to which stored bcrypt hashes are
+	// upgraded. When a password is verified against a stored bcrypt hash of
+	// lower cost, the hash is replaced with a new one of this cost. Plaintext
+	// and other hashed passwords are never rehashed. Peers do not rehash in
+	// step, so once a node has rehashed a user's password, its stored password
+	// is no longer accepted by their AAFromNode. It must therefore not be used
+	// with -join-as, whose credentials are passed between nodes as stored.
+	RehashCost int
+
+	// AllowHashLogin causes a user whose password is stored hashed to also be
+	// authenticated by supplying the stored hash itself, as well as by the
+	// password. This means the hash is as sensitive as the password. It is off
+	// by default, so only the password authenticates, except via AAFromNode.
+	AllowHashLogin bool
+
+	// HashPlaintextOnLoad causes plaintext passwords read by Load, LoadYAML,
+	// LoadCSV, LoadBinary, Merge, Reload and ReplaceAll, or passed to AddUser
+	// and Upsert, to be replaced with
+	// bcrypt hashes of cost HashPlaintextCost before they are stored, so the
+	// store never holds them in plaintext and Dump emits only hashes. Empty
+	// passwords are left as is. Each hash has a random salt, so nodes loading
+	// the same plaintext store different hashes, and a node's stored password
+	// is not accepted by its peers' AAFromNode. It must therefore not be used
+	// with -join-as, whose credentials are passed between nodes as stored.
+	HashPlaintextOnLoad bool
+
+	// HashPlaintextCost is the bcrypt cost used by HashPlaintextOnLoad. If not
+	// set, bcrypt.DefaultCost is used.
+	HashPlaintextCost int
+
+	// RequireNonEmpty causes Load, LoadYAML, LoadCSV, LoadBinary, Reload and
+	// ReplaceAll to return ErrNoCredentials, rather than succeed, if given no
+	// credentials.
+	RequireNonEmpty bool
+
+	// Realm is the realm sent in the WWW-Authenticate header of responses from
+	// handlers returned by Protect. If empty, DefaultRealm is used.
+	Realm string
+
+	// BatchWorkers is the maximum number of checks CheckBatch performs
+	// concurrently. If not positive, runtime.GOMAXPROCS(0) is used.
+	BatchWorkers int
+
+	// MaxBcryptCost is the highest bcrypt cost accepted in a stored hash. Load,
+	// Reload and AddUser return an error for a credential with a costlier hash,
+	// as verifying it could stall callers for seconds. NewCredentialsStore
+	// sets it to DefaultMaxBcryptCost, and zero disables the limit.
+	MaxBcryptCost int
+
+	// PasswordPolicy, if set, is the policy plaintext passwords supplied to
+	// AddUser must comply with. Nil, the default, accepts any password.
+	PasswordPolicy *PasswordPolicy
+
+	// CaseInsensitive causes usernames to be matched regardless of case, both
+	// when credentials are loaded and when they are looked up. It should be set
+	// before any credentials are loaded.
+	CaseInsensitive bool
+
+	// ReadPerms and WritePerms override DefaultReadPerms and DefaultWritePerms
+	// for CanRead and CanWrite, if set.
+	ReadPerms  []string
+	WritePerms []string
+
+	// StatementPerms overrides DefaultStatementPerms for CheckStatementPerm, if
+	// set.
+	StatementPerms map[string]string
 }
 
 // NewCredentialsStore returns a new instance of a CredentialStore.
 func NewCredentialsStore() *CredentialsStore {
 	return &CredentialsStore{
-		store: make(map[string]string),
-		perms: make(map[string]map[string]bool),
+		store:          make(map[string]string),
+		passwords:      make(map[string][]string),
+		perms:          make(map[string]PermSet),
+		denies:         make(map[string]PermSet),
+		tenants:        make(map[string]string),
+		tenantAllUsers: make(map[string]PermSet),
+		expires:        make(map[string]time.Time),
+		hashCache:      NewShardedHashCache(0),
+		now:            time.Now,
+		UseCache:       true,
+		MaxBcryptCost:  DefaultMaxBcryptCost,
 	}
 }
 
 // NewCredentialsStoreFromFile returns a new instance of a CredentialStore loaded from a file.
+// Files with a .yaml or .yml extension are loaded as YAML, and all others as JSON.
 func NewCredentialsStoreFromFile(path string) (*CredentialsStore, error) {
+	if isYAMLFile(path) {
+		return NewCredentialsStoreFromYAMLFile(path)
+	}
+
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -73,76 +348,1212 @@ func NewCredentialsStoreFromFile(path string) (*CredentialsStore, error) {
 	return c, c.Load(f)
 }
 
-// Load loads credential information from a reader.
+// NewCredentialsStoreFromJSON returns a new instance of a CredentialStore loaded
+// from data, a JSON array of credentials.
+func NewCredentialsStoreFromJSON(data []byte) (*CredentialsStore, error) {
+	c := NewCredentialsStore()
+	return c, c.Load(bytes.NewReader(data))
+}
+
+// NewCredentialsStoreFromEnv returns a new instance of a CredentialStore loaded
+// from the JSON array of credentials held in the environment variable name. It
+// is an error for the variable not to be set.
+func NewCredentialsStoreFromEnv(name string) (*CredentialsStore, error) {
+	data, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s not set", name)
+	}
+	return NewCredentialsStoreFromJSON([]byte(data))
+}
+
+// Load loads credential information from a reader. Any roles the credentials
+// refer to must already have been loaded via LoadRoles. It is an error for the
+// reader to hold anything other than a JSON array, or for the same username to
+// appear more than once.
 func (c *CredentialsStore) Load(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	// Read open bracket
-	_, err := dec.Token()
+	creds, err := decodeCredentials(r)
+	if err != nil {
+		return err
+	}
+	return c.load(creds)
+}
+
+// load adds creds to the store, as described by Load.
+func (c *CredentialsStore) load(creds []Credential) error {
+	if err := c.checkNonEmpty(creds); err != nil {
+		return err
+	}
+	if err := c.checkDuplicates(creds); err != nil {
+		return err
+	}
+	creds, err := c.maybeHashPlaintext(creds)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, cred := range creds {
+		if err := c.checkCredential(cred); err != nil {
+			return fmt.Errorf("%s at index %d", err.Error(), i)
+		}
+	}
+	for _, cred := range creds {
+		c.putCredential(cred)
+	}
+	c.warnPermless(creds)
+	return nil
+}
+
+// warnPermless warns of each user of creds who holds no perms, if StrictPerms
+// is set. The caller must hold the read lock.
+func (c *CredentialsStore) warnPermless(creds []Credential) {
+	if !c.StrictPerms {
+		return
+	}
+	for _, cred := range creds {
+		u := c.normalize(cred.Username)
+		if u != AllUsers && u != AuthedUsers && !c.isGroup(u) && c.permless(u) {
+			c.warn("user %q holds no perms", u)
+		}
+	}
+}
+
+// permless returns true if username holds no perms, not even via AllUsers,
+// including those of its tenant, or AuthedUsers. The caller must hold the
+// read lock.
+func (c *CredentialsStore) permless(username string) bool {
+	return len(c.authedEffectivePerms(username)) == 0 && len(c.tenantAllUsers[c.tenants[username]]) == 0
+}
+
+// Reload replaces all credential information in the store with that read from
+// a reader. Unlike Load, any user not present in the new credentials is removed.
+// The replacement is atomic, so concurrent calls to Check, AA, and the like see
+// either the old or the new credentials, never a mix. If the credentials cannot
+// be read the store is left unchanged.
+func (c *CredentialsStore) Reload(r io.Reader) error {
+	creds, err := decodeCredentials(r)
 	if err != nil {
 		return err
 	}
+	return c.ReplaceAll(creds)
+}
+
+// ReloadFromFile is like Reload, but reads the credentials from a file.
+func (c *CredentialsStore) ReloadFromFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.Reload(f)
+}
+
+// decodeCredentials reads a JSON array of Credentials from a reader. It is an
+// error for the reader to be empty, or to hold anything other than an array.
+func decodeCredentials(r io.Reader) ([]Credential, error) {
+	dec := json.NewDecoder(r)
+	// Read open bracket
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil, errors.New("empty credentials document, expected a JSON array")
+	} else if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('[') {
+		return nil, fmt.Errorf("credentials document is not a JSON array, starts with %v", tok)
+	}
 
-	var cred Credential
+	var creds []Credential
 	for dec.More() {
+		var cred Credential
 		err := dec.Decode(&cred)
 		if err != nil {
-			return err
-		}
-		c.store[cred.Username] = cred.Password
-		c.perms[cred.Username] = make(map[string]bool, len(cred.Perms))
-		for _, p := range cred.Perms {
-			c.perms[cred.Username][p] = true
+			return nil, err
 		}
+		creds = append(creds, cred)
 	}
 
 	// Read closing bracket.
 	_, err = dec.Token()
 	if err != nil {
+		return nil, err
+	}
+
+	return creds, nil
+}
+
+// ReplaceAll replaces every credential in the store with creds, removing any
+// user not present in creds. All credentials are validated first, and if any
+// is invalid an error is returned and the store is left unchanged.
+func (c *CredentialsStore) ReplaceAll(creds []Credential) error {
+	for i, cred := range creds {
+		if err := validateCredential(cred); err != nil {
+			return fmt.Errorf("%s at index %d", err.Error(), i)
+		}
+	}
+	if err := c.checkNonEmpty(creds); err != nil {
 		return err
 	}
+	if err := c.checkDuplicates(creds); err != nil {
+		return err
+	}
+	creds, err := c.maybeHashPlaintext(creds)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, cred := range creds {
+		if err := c.checkCredential(cred); err != nil {
+			return fmt.Errorf("%s at index %d", err.Error(), i)
+		}
+	}
+	oldStore, oldPasswords := c.store, c.passwords
+	c.store = make(map[string]string, len(creds))
+	c.passwords = make(map[string][]string)
+	c.perms = make(map[string]PermSet, len(creds))
+	c.rolePerms = nil
+	c.denies = make(map[string]PermSet)
+	c.tenants = make(map[string]string)
+	c.expires = make(map[string]time.Time)
+	c.tenantAllUsers = make(map[string]PermSet)
+	if c.effective != nil {
+		c.effective = make(map[string]PermSet, len(creds))
+	}
+	for _, cred := range creds {
+		c.putCredential(cred)
+	}
+	c.warnPermless(creds)
+
+	// Discard cached verifications of users whose passwords have changed, or
+	// who have been removed.
+	for u, pw := range oldStore {
+		old, ok := oldPasswords[u]
+		if !ok {
+			old = []string{pw}
+		}
+		if !slices.Equal(old, c.passwordsOf(u)) {
+			c.invalidateCaches(u)
+		}
+	}
+	return nil
+}
+
+// checkNonEmpty returns ErrNoCredentials if RequireNonEmpty is set and creds
+// is empty.
+func (c *CredentialsStore) checkNonEmpty(creds []Credential) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.RequireNonEmpty && len(creds) == 0 {
+		return ErrNoCredentials
+	}
+	return nil
+}
+
+// maybeHashPlaintext returns creds with plaintext passwords hashed if
+// HashPlaintextOnLoad is set, and creds unchanged otherwise. Hashing is done
+// without holding the lock, as it may be slow.
+func (c *CredentialsStore) maybeHashPlaintext(creds []Credential) ([]Credential, error) {
+	c.mu.RLock()
+	enabled, cost := c.HashPlaintextOnLoad, c.HashPlaintextCost
+	c.mu.RUnlock()
+	if !enabled {
+		return creds, nil
+	}
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return hashPlaintext(creds, cost)
+}
+
+// checkDuplicates returns an error if the same username appears more than once
+// in creds. AllUsers may appear once per tenant.
+func (c *CredentialsStore) checkDuplicates(creds []Credential) error {
+	type key struct{ username, tenant string }
+	seen := make(map[key]bool, len(creds))
+	for i, cred := range creds {
+		k := key{c.normalize(cred.Username), cred.Tenant}
+		if cred.Username != AllUsers {
+			k.tenant = ""
+		}
+		if seen[k] {
+			return fmt.Errorf("duplicate username %q at index %d", cred.Username, i)
+		}
+		seen[k] = true
+	}
+	return nil
+}
+
+// AddUser adds cred to the store, or replaces the password and perms of the
+// user if it is already present. If the user's password changes, any cached
+// verifications of the old password are discarded. If PasswordPolicy is set,
+// plaintext passwords which do not comply with it are rejected, before any are
+// hashed by HashPlaintextOnLoad.
+func (c *CredentialsStore) AddUser(cred Credential) error {
+	c.mu.RLock()
+	policy := c.PasswordPolicy
+	c.mu.RUnlock()
+	if err := checkPasswordPolicy(policy, cred); err != nil {
+		return err
+	}
+	return c.Upsert(cred)
+}
+
+// RemoveUser removes username from the store, returning true if the user was
+// present.
+func (c *CredentialsStore) RemoveUser(username string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	username = c.normalize(username)
+	_, inStore := c.store[username]
+	_, inPerms := c.perms[username]
+	delete(c.store, username)
+	delete(c.passwords, username)
+	delete(c.perms, username)
+	c.updateEffective(username)
+	delete(c.rolePerms, username)
+	delete(c.denies, username)
+	delete(c.tenants, username)
+	delete(c.expires, username)
+	delete(c.sizeLimits, username)
+	delete(c.failures, username)
+	c.forgetLogin(username)
+	c.invalidateCaches(username)
+	return inStore || inPerms
+}
+
+// Upsert adds cred to the store, or replaces the password and perms of the user
+// if it is already present. It is the single-credential counterpart to Load.
+func (c *CredentialsStore) Upsert(cred Credential) error {
+	if err := validateCredential(cred); err != nil {
+		return err
+	}
+	creds, err := c.maybeHashPlaintext([]Credential{cred})
+	if err != nil {
+		return err
+	}
+	cred = creds[0]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkCredential(cred); err != nil {
+		return err
+	}
+	c.putCredential(cred)
+	return nil
+}
+
+// validateCredential returns an error if cred cannot be added to a store.
+func validateCredential(cred Credential) error {
+	if cred.Username == "" {
+		return errors.New("empty username")
+	}
+	return nil
+}
+
+// checkUsername returns an error if username contains a colon, a control
+// character, or leading or trailing whitespace, any of which could corrupt
+// basic auth headers or log lines. The colon of GroupPrefix is allowed.
+func checkUsername(username string) error {
+	if strings.Contains(strings.TrimPrefix(username, GroupPrefix), ":") {
+		return fmt.Errorf("username %q contains a colon", username)
+	}
+	if strings.IndexFunc(username, unicode.IsControl) >= 0 {
+		return fmt.Errorf("username %q contains a control character", username)
+	}
+	if strings.TrimSpace(username) != username {
+		return fmt.Errorf("username %q has leading or trailing whitespace", username)
+	}
+	return nil
+}
+
+// checkCredential returns an error if cred has a malformed username or expiry,
+// if cred has a bcrypt hash costlier than MaxBcryptCost, if cred refers to an
+// undefined role, if StrictPerms is set and cred grants an unknown perm, or if
+// ValidateOnLoad is set and cred's passwords are invalid. The caller must hold
+// the read lock.
+func (c *CredentialsStore) checkCredential(cred Credential) error {
+	if err := checkUsername(cred.Username); err != nil {
+		return err
+	}
+	if _, err := parseExpires(cred.Expires); err != nil {
+		return fmt.Errorf("invalid expiry for user %q: %w", cred.Username, err)
+	}
+	if err := checkBcryptCost(cred, c.MaxBcryptCost); err != nil {
+		return err
+	}
+	if err := c.checkRoles(cred); err != nil {
+		return err
+	}
+	if c.StrictPerms {
+		if err := checkPerms(cred); err != nil {
+			return err
+		}
+	}
+	if c.ValidateOnLoad && cred.Username != AllUsers && cred.Username != AuthedUsers {
+		return checkPasswords(cred)
+	}
+	return nil
+}
+
+// checkPasswords returns an error if cred has no password, or has a password
+// which begins like a bcrypt or Argon2id hash but is not a valid one.
+func checkPasswords(cred Credential) error {
+	pws := append([]string{cred.Password}, cred.Passwords...)
+	empty := true
+	for _, pw := range pws {
+		if pw == "" {
+			continue
+		}
+		empty = false
+		if strings.HasPrefix(pw, "$2") {
+			if _, err := bcrypt.Cost([]byte(pw)); err != nil {
+				return fmt.Errorf("invalid bcrypt hash for user %q: %s", cred.Username, err.Error())
+			}
+		}
+		if isArgon2idHash(pw) {
+			if _, _, _, _, _, err := parseArgon2id(pw); err != nil {
+				return fmt.Errorf("invalid argon2id hash for user %q: %s", cred.Username, err.Error())
+			}
+		}
+	}
+	if empty {
+		return fmt.Errorf("empty password for user %q", cred.Username)
+	}
+	return nil
+}
 
+// checkBcryptCost returns an error if any password of cred is a bcrypt hash with
+// a cost greater than maxCost. If maxCost is not positive, any cost is allowed.
+// Malformed hashes are not reported, as that is left to checkPasswords.
+func checkBcryptCost(cred Credential, maxCost int) error {
+	if maxCost <= 0 {
+		return nil
+	}
+	for _, pw := range append([]string{cred.Password}, cred.Passwords...) {
+		if !isBcryptHash(pw) {
+			continue
+		}
+		if cost, err := bcrypt.Cost([]byte(pw)); err == nil && cost > maxCost {
+			return fmt.Errorf("bcrypt hash for user %q has cost %d, exceeding maximum of %d",
+				cred.Username, cost, maxCost)
+		}
+	}
 	return nil
 }
 
-// Check returns true if the password is correct for the given username.
+// putCredential adds cred to the store, replacing any existing credential for
+// the same user. The perms of cred's roles are added to its direct perms, and
+// its perms are normalized by normalizePerms. The caller must hold the write
+// lock.
+func (c *CredentialsStore) putCredential(cred Credential) {
+	cred.Username = c.normalize(cred.Username)
+	var dropped int
+	if cred.Perms, dropped = normalizePerms(cred.Perms); dropped > 0 {
+		c.warn("dropped %d empty perms of user %q", dropped, cred.Username)
+	}
+	if cred.Deny, dropped = normalizePerms(cred.Deny); dropped > 0 {
+		c.warn("dropped %d empty denied perms of user %q", dropped, cred.Username)
+	}
+	perms := NewPermSet(cred.Perms...)
+	var viaRole map[string]string
+	for _, r := range cred.Roles {
+		for _, p := range c.roles[r] {
+			if perms[p] {
+				continue
+			}
+			if viaRole == nil {
+				viaRole = make(map[string]string)
+			}
+			perms[p] = true
+			viaRole[p] = r
+		}
+	}
+
+	if cred.Username == AllUsers && cred.Tenant != "" {
+		c.tenantAllUsers[cred.Tenant] = perms
+		return
+	}
+
+	pws := cred.Passwords
+	if cred.Password != "" || len(pws) == 0 {
+		pws = append([]string{cred.Password}, pws...)
+	}
+	if old := c.passwordsOf(cred.Username); old != nil && !slices.Equal(old, pws) {
+		c.invalidateCaches(cred.Username)
+	}
+	c.store[cred.Username] = pws[0]
+	if len(pws) > 1 {
+		c.passwords[cred.Username] = slices.Clone(pws)
+	} else {
+		delete(c.passwords, cred.Username)
+	}
+	c.perms[cred.Username] = perms
+	c.updateEffective(cred.Username)
+	if viaRole != nil {
+		if c.rolePerms == nil {
+			c.rolePerms = make(map[string]map[string]string)
+		}
+		c.rolePerms[cred.Username] = viaRole
+	} else {
+		delete(c.rolePerms, cred.Username)
+	}
+	if cred.Tenant != "" {
+		c.tenants[cred.Username] = cred.Tenant
+	} else {
+		delete(c.tenants, cred.Username)
+	}
+	if len(cred.Deny) > 0 {
+		c.denies[cred.Username] = NewPermSet(cred.Deny...)
+	} else {
+		delete(c.denies, cred.Username)
+	}
+	if t, err := parseExpires(cred.Expires); err == nil && !t.IsZero() {
+		c.expires[cred.Username] = t
+	} else {
+		delete(c.expires, cred.Username)
+	}
+}
+
+// parseExpires parses s as an RFC3339 expiry time. An empty s is parsed as the
+// zero time, meaning no expiry.
+func parseExpires(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// isExpired returns whether username's credential has expired. The caller must
+// hold the read lock.
+func (c *CredentialsStore) isExpired(username string) bool {
+	t, ok := c.expires[username]
+	return ok && !c.now().Before(t)
+}
+
+// LoadInvertedPerms loads perms from a reader containing a JSON object mapping
+// each perm to the list of usernames granted it, for example
+// {"execute": ["alice", "bob"]}. The perms are added to any already granted,
+// and passwords are not affected, so it can be combined with Load. Usernames
+// and, if StrictPerms is set, perms are checked as by Load, and if any is
+// rejected an error is returned and the store is left unchanged.
+func (c *CredentialsStore) LoadInvertedPerms(r io.Reader) error {
+	var inverted map[string][]string
+	if err := json.NewDecoder(r).Decode(&inverted); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for perm, usernames := range inverted {
+		for _, u := range usernames {
+			cred := Credential{Username: u, Perms: []string{perm}}
+			if err := validateCredential(cred); err != nil {
+				return fmt.Errorf("%s for perm %q", err.Error(), perm)
+			}
+			if err := checkUsername(u); err != nil {
+				return err
+			}
+			if c.StrictPerms {
+				if err := checkPerms(cred); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for perm, usernames := range inverted {
+		for _, u := range usernames {
+			u = c.normalize(u)
+			if _, ok := c.perms[u]; !ok {
+				c.perms[u] = make(PermSet)
+			}
+			c.perms[u][perm] = true
+		}
+	}
+	if c.effective != nil {
+		c.rebuildEffective()
+	}
+	return nil
+}
+
+// SetAuthGate sets a function which is consulted each time a user is
+// authenticated. If gate returns false for a username, authentication fails
+// even if the correct password is supplied. Passing nil removes the gate, which
+// is the default.
+func (c *CredentialsStore) SetAuthGate(gate func(username string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.authGate = gate
+}
+
+// SetHashCache sets the cache used to store successful verifications of hashed
+// passwords, for example one created by NewHashCacheWithSize. By default the
+// cache is one created by NewShardedHashCache with DefaultHashCacheShards
+// shards, so concurrent checks of different users rarely contend for a lock.
+func (c *CredentialsStore) SetHashCache(hc *HashCache) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hashCache = hc
+}
+
+// SetNegativeHashCache sets a cache used to store failed verifications of
+// hashed passwords, so that repeating the same wrong password does not cost a
+// hash computation each time. Its size and TTL are configured independently of
+// the cache set by SetHashCache, for example via NewHashCacheWithSize and
+// WithTTL, and a short TTL is advisable. Passing nil disables negative caching,
+// which is the default.
+func (c *CredentialsStore) SetNegativeHashCache(hc *HashCache) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.negHashCache = hc
+}
+
+// CacheInfo describes the hash caches of a store, as returned by
+// CredentialsStore.CacheInfo.
+type CacheInfo struct {
+	// Enabled is whether UseCache is set, so that successful verifications
+	// are cached.
+	Enabled bool
+
+	// Cache describes the cache of successful verifications.
+	Cache HashCacheConfig
+
+	// NegativeCache describes the cache of failed verifications set by
+	// SetNegativeHashCache, or is nil if there is none.
+	NegativeCache *HashCacheConfig
+}
+
+// CacheInfo returns the store's cache settings, so operators can confirm the
+// tuning of UseCache, SetHashCache and SetNegativeHashCache took effect.
+func (c *CredentialsStore) CacheInfo() CacheInfo {
+	c.mu.RLock()
+	enabled, hc, negHC := c.UseCache, c.hashCache, c.negHashCache
+	c.mu.RUnlock()
+	info := CacheInfo{
+		Enabled: enabled,
+		Cache:   hc.Config(),
+	}
+	if negHC != nil {
+		cfg := negHC.Config()
+		info.NegativeCache = &cfg
+	}
+	return info
+}
+
+// invalidateCaches discards all cached verifications, successful or failed,
+// for username. The caller must hold the write lock.
+func (c *CredentialsStore) invalidateCaches(username string) {
+	c.hashCache.Invalidate(username)
+	if c.negHashCache != nil {
+		c.negHashCache.Invalidate(username)
+	}
+}
+
+// clearCaches discards all cached verifications, successful or failed. The
+// caller must hold the write lock.
+func (c *CredentialsStore) clearCaches() {
+	c.hashCache.Clear()
+	if c.negHashCache != nil {
+		c.negHashCache.Clear()
+	}
+}
+
+// Check returns true if the password is correct for the given username. If a
+// lockout policy is set, it returns false for a user who is locked out.
 func (c *CredentialsStore) Check(username, password string) bool {
-	pw, ok := c.store[username]
-	return ok && pw == password
+	ok, _ := c.checkE(context.Background(), username, password, checkOptions{explicit: true})
+	return ok
+}
+
+// CheckE is like Check, but also returns an error describing why the check
+// failed, for logging. It is ErrUserNotFound if username is not in the store,
+// ErrBadPassword if the password is incorrect, ErrLockedOut if the user is
+// locked out, ErrExpired if the user's credential has expired, and
+// ErrDeniedByGate if the auth gate denied the user. If the stored password
+// looks like a hash but is malformed, the error describes why.
+// The boolean alone determines whether the user is authenticated.
+func (c *CredentialsStore) CheckE(username, password string) (bool, error) {
+	return c.checkE(context.Background(), username, password, checkOptions{explicit: true})
+}
+
+// CheckContext is like Check, but gives up waiting for a slow password hash
+// computation if ctx is done, returning false and ctx.Err(). Checks which need
+// no hash computation, such as of plaintext passwords or of verifications
+// already cached, complete regardless of ctx.
+func (c *CredentialsStore) CheckContext(ctx context.Context, username, password string) (bool, error) {
+	ok, err := c.checkE(ctx, username, password, checkOptions{explicit: true})
+	if err != nil && err == ctx.Err() {
+		return false, err
+	}
+	return ok, nil
+}
+
+// checkOptions modify how a password, or by aa a request, is checked.
+type checkOptions struct {
+	// hashLogin causes a stored hash to be accepted as the password, as if
+	// AllowHashLogin were set.
+	hashLogin bool
+
+	// dryRun causes the check to leave no trace: lockout state, Stats, last
+	// logins, the failure rate, the hash caches, stored hashes and the audit
+	// hook are all left untouched.
+	dryRun bool
+
+	// explicit marks a check made by Check, CheckE or CheckContext, rather
+	// than on behalf of a request, so that it counts as the recent
+	// authentication required by SetRecentAuthRequirement.
+	explicit bool
+
+	// lean causes the check to skip instrumentation, as for Lean.
+	lean bool
+
+	// tenanted causes aa to authorize the request only if the user belongs to
+	// tenant, consulting only the AllUsers grants made for that tenant, as
+	// HasTenantPerm does.
+	tenanted bool
+	tenant   string
+}
+
+// count increments the counter n, unless the check is a dry run or lean.
+func (o checkOptions) count(n *int64) {
+	if !o.dryRun && !o.lean {
+		atomic.AddInt64(n, 1)
+	}
+}
+
+// checkE implements CheckE, returning ctx.Err() if ctx is done while waiting for
+// a hash computation.
+func (c *CredentialsStore) checkE(ctx context.Context, username, password string, opts checkOptions) (bool, error) {
+	c.mu.RLock()
+	username = c.normalize(username)
+	gate, lockout := c.authGate, c.lockout != nil
+	locked := c.isLockedOut(username)
+	opts.lean = opts.lean || c.Lean
+	latencyHook := c.checkLatencyHook
+	c.mu.RUnlock()
+	opts.count(&c.stats.Checks)
+	if opts.dryRun {
+		lockout = false
+	}
+	if opts.dryRun || opts.lean {
+		latencyHook = nil
+	}
+	if locked || (lockout && !c.reserveAttempt(username)) {
+		opts.count(&c.stats.LockedOut)
+		return false, ErrLockedOut
+	}
+
+	var start time.Time
+	if latencyHook != nil {
+		start = time.Now()
+	}
+	path, err := c.verify(ctx, username, password, opts)
+	if latencyHook != nil {
+		latencyHook(path, time.Since(start))
+	}
+	if err != nil && err == ctx.Err() {
+		return false, err
+	}
+	if lockout && err == nil {
+		c.resetAttempts(username)
+	}
+	if err != nil {
+		if !opts.dryRun {
+			c.recordFailure()
+		}
+		if err == ErrUserNotFound {
+			opts.count(&c.stats.UnknownUser)
+		} else {
+			opts.count(&c.stats.BadPassword)
+		}
+		return false, err
+	}
+	c.mu.RLock()
+	expired := c.isExpired(username)
+	c.mu.RUnlock()
+	if expired {
+		return false, ErrExpired
+	}
+	if gate != nil && !gate(username) {
+		return false, ErrDeniedByGate
+	}
+	if !opts.dryRun && (!opts.lean || opts.explicit) {
+		c.recordLogin(username, opts.explicit)
+	}
+	return true, nil
+}
+
+// passwordMatches returns true if password is correct for the given username.
+// Unlike Check, it does not consult the auth gate, and leaves no trace, as for
+// a dry run.
+func (c *CredentialsStore) passwordMatches(username, password string) bool {
+	_, err := c.verify(context.Background(), username, password, checkOptions{dryRun: true})
+	return err == nil
+}
+
+// verify returns nil if password is correct for the given username, or an
+// error as described by CheckE. If the user has more than one password, it is
+// correct if it matches any of them. If a hash computation is needed, it is
+// performed as by compareContext, or on the hashing pool if one is set, so
+// ctx.Err() is returned if ctx is done first. The path taken, as reported to
+// the check latency hook, is also returned.
+func (c *CredentialsStore) verify(ctx context.Context, username, password string, opts checkOptions) (path string, err error) {
+	c.mu.RLock()
+	username = c.normalize(username)
+	pws := c.passwordsOf(username)
+	if username == AllUsers || username == AuthedUsers || c.isGroup(username) {
+		// AllUsers, AuthedUsers and groups are not real users, so must never
+		// authenticate, else they could be used to obtain the perms of
+		// AuthedUsers, or their own, without credentials.
+		pws = nil
+	}
+	allowEmpty, emptyMatchesAny := c.AllowEmptyPassword, c.EmptyPasswordMatchesAny
+	useCache, hc, negHC := c.UseCache, c.hashCache, c.negHashCache
+	rehashCost := c.RehashCost
+	allowHashLogin := opts.hashLogin || c.AllowHashLogin
+	verifier := c.verifier
+	compareCtx := compareContext
+	if c.hashingPool != nil {
+		compareCtx = c.hashingPool.compare
+	}
+	c.mu.RUnlock()
+	if opts.dryRun {
+		useCache, negHC, rehashCost = false, nil, 0
+	}
+
+	if pws == nil {
+		// Perform a comparison anyway, so unknown users can't be distinguished
+		// from known users by how quickly plaintext checks fail.
+		constantTimeEqual(password, password+"\x00")
+		return CheckPathPlaintext, ErrUserNotFound
+	}
+
+	// path is the most expensive path taken for any of the passwords.
+	path = CheckPathPlaintext
+	verifyOne := func(pw string) error {
+		if pw == "" {
+			if allowEmpty && (password == "" || emptyMatchesAny) {
+				return nil
+			}
+			return ErrBadPassword
+		}
+		compare := comparePassword
+		if verifier != nil {
+			compare = verifierCompare(verifier)
+		} else {
+			if !isHashed(pw) {
+				if constantTimeEqual(password, pw) {
+					return nil
+				}
+				return ErrBadPassword
+			}
+			if allowHashLogin && constantTimeEqual(password, pw) {
+				return nil
+			}
+		}
+
+		key := cacheKey(pw, password)
+		if useCache {
+			if hc.Check(username, key) {
+				opts.count(&c.stats.CacheHits)
+				if path != CheckPathHash {
+					path = CheckPathCacheHit
+				}
+				return nil
+			}
+			opts.count(&c.stats.CacheMisses)
+		}
+		if negHC != nil && negHC.Check(username, key) {
+			opts.count(&c.stats.NegativeCacheHits)
+			if path != CheckPathHash {
+				path = CheckPathCacheHit
+			}
+			return ErrBadPassword
+		}
+		opts.count(&c.stats.HashComputations)
+		path = CheckPathHash
+		if err := compareCtx(ctx, compare, pw, password); err != nil {
+			if negHC != nil && err == ErrBadPassword {
+				negHC.Store(username, key)
+			}
+			return err
+		}
+		if useCache {
+			hc.Store(username, key)
+		}
+		if rehashCost > 0 && isBcryptHash(pw) {
+			c.rehash(username, pw, password, rehashCost)
+		}
+		return nil
+	}
+
+	// Report a malformed hash in preference to a bad password, as it is the
+	// more useful diagnosis.
+	var firstErr error
+	for _, pw := range pws {
+		err := verifyOne(pw)
+		if err == nil || err == ctx.Err() {
+			return path, err
+		}
+		if firstErr == nil || firstErr == ErrBadPassword {
+			firstErr = err
+		}
+	}
+	return path, firstErr
+}
+
+// passwordsOf returns every password of username, or nil if username is not in
+// the store. The returned slice must not be modified. The caller must hold the
+// read lock.
+func (c *CredentialsStore) passwordsOf(username string) []string {
+	if pws, ok := c.passwords[username]; ok {
+		return pws
+	}
+	if pw, ok := c.store[username]; ok {
+		return []string{pw}
+	}
+	return nil
+}
+
+// rehash replaces stored, the bcrypt hash of password stored for username, with
+// a hash of the given cost if stored has a lower cost. The hash is not replaced
+// if it is no longer a password of username.
+func (c *CredentialsStore) rehash(username, stored, password string, cost int) {
+	if cur, err := bcrypt.Cost([]byte(stored)); err != nil || cur >= cost {
+		return
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pws, ok := c.passwords[username]; ok {
+		i := slices.Index(pws, stored)
+		if i < 0 {
+			return
+		}
+		// Replace rather than modify the slice, as it may be in use by verify.
+		pws = slices.Clone(pws)
+		pws[i] = string(b)
+		c.passwords[username] = pws
+		c.store[username] = pws[0]
+	} else if c.store[username] == stored {
+		c.store[username] = string(b)
+	} else {
+		return
+	}
+	c.invalidateCaches(username)
 }
 
-// Password returns the password for the given user.
+// DetectDefaultCredentials returns the sorted usernames whose password still
+// matches the password of a known default credential for the same username,
+// for example admin/admin. It can be used to warn operators at startup. As for
+// AADryRun, Stats, the hash caches and stored hashes are left untouched.
+func (c *CredentialsStore) DetectDefaultCredentials(knownDefaults []Credential) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, d := range knownDefaults {
+		if seen[d.Username] {
+			continue
+		}
+		if c.passwordMatches(d.Username, d.Password) {
+			usernames = append(usernames, d.Username)
+			seen[d.Username] = true
+		}
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+// Password returns the password for the given user. If the user has more than
+// one password, the first is returned.
 func (c *CredentialsStore) Password(username string) (string, bool) {
-	pw, ok := c.store[username]
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	pw, ok := c.store[c.normalize(username)]
 	return pw, ok
 }
 
 // CheckRequest returns true if b contains a valid username and password.
 func (c *CredentialsStore) CheckRequest(b BasicAuther) bool {
+	_, ok := c.AuthenticateRequest(b)
+	return ok
+}
+
+// AuthenticateRequest is like CheckRequest, but also returns the username b
+// authenticated as, so callers need not extract it again. The username is as
+// keyed in the store, so is lower-cased if CaseInsensitive is set, and is
+// empty unless ok is true.
+func (c *CredentialsStore) AuthenticateRequest(b BasicAuther) (username string, ok bool) {
 	username, password, ok := b.BasicAuth()
-	if !ok || !c.Check(username, password) {
-		return false
+	if !ok {
+		return "", false
 	}
-	return true
+	if ok, _ := c.checkE(context.Background(), username, password, checkOptions{}); !ok {
+		return "", false
+	}
+	return c.normalize(username), true
 }
 
 // HasPerm returns true if username has the given perm, either directly or
-// via AllUsers. It does not perform any password checking.
+// via AllUsers, or via its groups if a GroupResolver is set. A wildcard perm
+// such as "query:*" grants every perm beginning "query:". A perm denied to
+// username is never held, as an explicit denial takes precedence over any
+// grant. It does not perform any password checking.
 func (c *CredentialsStore) HasPerm(username string, perm string) bool {
-	if m, ok := c.perms[username]; ok {
-		if _, ok := m[perm]; ok {
+	c.mu.RLock()
+	if c.isDenied(username, perm) {
+		c.mu.RUnlock()
+		return false
+	}
+	if c.holdsPerm(username, perm) {
+		c.mu.RUnlock()
+		return true
+	}
+	resolver, gc := c.groupResolver, c.groups
+	c.mu.RUnlock()
+	if resolver == nil {
+		return false
+	}
+
+	// The resolver may be slow, so is called without the lock held.
+	groups := c.resolveGroups(resolver, gc, username)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, g := range groups {
+		if c.holdsPerm(GroupPrefix+g, perm) {
 			return true
 		}
 	}
+	return false
+}
 
-	if m, ok := c.perms[AllUsers]; ok {
-		if _, ok := m[perm]; ok {
+// holdsPerm returns true if username is granted perm, or a perm which implies
+// it, either directly or via AllUsers. Denials are not considered. The caller
+// must hold the read lock.
+func (c *CredentialsStore) holdsPerm(username, perm string) bool {
+	if c.hasPerm(username, perm) {
+		return true
+	}
+	for _, p := range c.impliedBy[perm] {
+		if c.hasPerm(username, p) {
 			return true
 		}
 	}
-
 	return false
 }
 
+// isDenied returns true if perm is denied to username. The caller must hold the
+// read lock.
+func (c *CredentialsStore) isDenied(username, perm string) bool {
+	return c.denies[c.normalize(username)].Has(perm)
+}
+
+// authorized returns true if username has perm, or has PermAll, and perm is not
+// denied to username. It does not perform any password checking.
+func (c *CredentialsStore) authorized(username, perm string) bool {
+	c.mu.RLock()
+	denied := c.isDenied(username, perm)
+	c.mu.RUnlock()
+	return !denied && c.HasAnyPerm(username, perm, PermAll)
+}
+
+// authedUsersAuthorized returns true if AuthedUsers has perm, or has PermAll,
+// and perm is not denied to username. It does not perform any password
+// checking.
+func (c *CredentialsStore) authedUsersAuthorized(username, perm string) bool {
+	c.mu.RLock()
+	denied := c.isDenied(username, perm)
+	c.mu.RUnlock()
+	return !denied && c.HasAnyPerm(AuthedUsers, perm, PermAll)
+}
+
+// hasPerm returns true if username is granted perm, either directly or via
+// AllUsers, without considering implied perms. The caller must hold the read
+// lock.
+func (c *CredentialsStore) hasPerm(username string, perm string) bool {
+	username = c.normalize(username)
+	if c.effective != nil {
+		if m, ok := c.effective[username]; ok {
+			return m.Has(perm)
+		}
+		return c.perms[AllUsers].Has(perm)
+	}
+	return c.perms[username].Has(perm) || c.perms[AllUsers].Has(perm)
+}
+
+// SetPermImplications sets which perms imply other perms, such that HasPerm
+// returns true for a perm if the user holds any perm which implies it. For
+// example, with DefaultPermImplications a user granted PermExecute also has
+// PermQuery. Implications are transitive. By default no perm implies another,
+// and passing nil restores that default.
+func (c *CredentialsStore) SetPermImplications(implies map[string][]string) {
+	impliedBy := make(map[string][]string)
+	for granted := range implies {
+		for _, p := range impliedPerms(implies, granted) {
+			impliedBy[p] = append(impliedBy[p], granted)
+		}
+	}
+	for p := range impliedBy {
+		sort.Strings(impliedBy[p])
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.implies = make(map[string][]string, len(implies))
+	for k, v := range implies {
+		c.implies[k] = append([]string(nil), v...)
+	}
+	c.impliedBy = impliedBy
+}
+
+// impliedPerms returns every perm transitively implied by perm, excluding perm
+// itself.
+func impliedPerms(implies map[string][]string, perm string) []string {
+	seen := map[string]bool{perm: true}
+	var out []string
+	queue := []string{perm}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, q := range implies[p] {
+			if !seen[q] {
+				seen[q] = true
+				out = append(out, q)
+				queue = append(queue, q)
+			}
+		}
+	}
+	return out
+}
+
+// Users returns the sorted usernames of every user in the store. AllUsers and
+// AuthedUsers are not included, even if perms are granted to them.
+func (c *CredentialsStore) Users() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	users := make([]string, 0, len(c.store)+len(c.perms))
+	for u := range c.store {
+		if u != AllUsers && u != AuthedUsers {
+			users = append(users, u)
+		}
+	}
+	for u := range c.perms {
+		if _, ok := c.store[u]; !ok && u != AllUsers && u != AuthedUsers {
+			users = append(users, u)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+// Perms returns the sorted effective perms of username, including those
+// granted via AllUsers and those implied by other perms. It does not perform any
+// password checking, so, like HasPerm, it does not include perms granted to
+// AuthedUsers, which are held only once username has authenticated.
+// CapabilitiesJSON, which describes an authenticated user, includes them.
+func (c *CredentialsStore) Perms(username string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.effectivePerms(username).Slice()
+}
+
+// Snapshot returns a copy of the effective perms of every user, as returned by
+// Perms, keyed by username. AllUsers is always included, so anonymous grants
+// can be seen. The snapshot is taken at a single point in time, and is not
+// affected by later changes to the store.
+func (c *CredentialsStore) Snapshot() map[string][]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	snap := make(map[string][]string, len(c.store)+len(c.perms)+1)
+	for u := range c.store {
+		snap[u] = c.effectivePerms(u).Slice()
+	}
+	for u := range c.perms {
+		if _, ok := snap[u]; !ok {
+			snap[u] = c.effectivePerms(u).Slice()
+		}
+	}
+	if _, ok := snap[AllUsers]; !ok {
+		snap[AllUsers] = c.effectivePerms(AllUsers).Slice()
+	}
+	return snap
+}
+
+// InheritedPerms returns the sorted perms username holds solely because they
+// are granted to AllUsers, and not granted to username directly, whether
+// exactly or via a wildcard perm. Perms denied to username are not held, so
+// are not included.
+func (c *CredentialsStore) InheritedPerms(username string) []string {
+	if username == AllUsers {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	username = c.normalize(username)
+	var perms []string
+	for p := range c.perms[AllUsers] {
+		if !c.perms[username].Has(p) && !c.isDenied(username, p) {
+			perms = append(perms, p)
+		}
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+// PermsWithPrefix returns the sorted perms username has, either directly or
+// via AllUsers, which begin with prefix. As for Perms, perms granted to
+// AuthedUsers are not included.
+func (c *CredentialsStore) PermsWithPrefix(username, prefix string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var perms []string
+	for p := range c.effectivePerms(username) {
+		if strings.HasPrefix(p, prefix) {
+			perms = append(perms, p)
+		}
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+// effectivePerms returns a new set of the perms username has, either directly
+// or via AllUsers, less any denied to username. As for HasPerm, the AllUsers
+// grants of the user's tenant are not included, as only HasTenantPerm and
+// AATenant consult them. The caller must hold the read lock.
+func (c *CredentialsStore) effectivePerms(username string) PermSet {
+	username = c.normalize(username)
+	effective := c.perms[username].Union(c.perms[AllUsers])
+	if len(c.implies) > 0 {
+		for p := range effective {
+			effective.Add(impliedPerms(c.implies, p)...)
+		}
+	}
+	for p := range effective {
+		if c.isDenied(username, p) {
+			delete(effective, p)
+		}
+	}
+	return effective
+}
+
+// authedEffectivePerms returns a new set of the perms username has once
+// authenticated: those returned by effectivePerms, and those granted to
+// AuthedUsers, less any denied to username. The caller must hold the read lock.
+func (c *CredentialsStore) authedEffectivePerms(username string) PermSet {
+	effective := c.effectivePerms(username).Union(c.effectivePerms(AuthedUsers))
+	for p := range effective {
+		if c.isDenied(username, p) {
+			delete(effective, p)
+		}
+	}
+	return effective
+}
+
 // HasAnyPerm returns true if username has at least one of the given perms,
 // either directly, or via AllUsers. It does not perform any password checking.
 func (c *CredentialsStore) HasAnyPerm(username string, perm ...string) bool {
@@ -156,33 +1567,257 @@ func (c *CredentialsStore) HasAnyPerm(username string, perm ...string) bool {
 	}(perm)
 }
 
+// Enabled returns whether authentication is in effect. A nil store means
+// auth is disabled, and every request is allowed.
+func (c *CredentialsStore) Enabled() bool {
+	return c != nil
+}
+
+// IsAnonymous returns whether the given username represents an anonymous
+// request, i.e. one where no credentials were supplied.
+func IsAnonymous(username string) bool {
+	return username == ""
+}
+
 // AA authenticates and checks authorization for the given username and password
 // for the given perm. If the credential store is nil, then this function always
 // returns true. If AllUsers have the given perm, authentication is not done.
-// Only then are the credentials checked, and then the perm checked.
+// Only then are the credentials checked, and then the perm checked, first as
+// granted to AuthedUsers and then as granted to the user.
 func (c *CredentialsStore) AA(username, password, perm string) bool {
+	allowed, _ := c.AAResult(username, password, perm)
+	return allowed
+}
+
+// AAResult is like AA, but also returns the principal the request was allowed
+// as. This is the username, as keyed in the store, if the credentials were
+// checked, and empty if access was allowed without them, because the store is
+// nil or AllUsers have the perm.
+func (c *CredentialsStore) AAResult(username, password, perm string) (allowed bool, authenticatedUser string) {
+	allowed, authenticatedUser, _ = c.aa(username, password, perm, -1, checkOptions{})
+	return allowed, authenticatedUser
+}
+
+// AAFromNode is like AA, but is for requests from other nodes of the cluster,
+// which pass on the credentials of a user as stored. So a user whose password
+// is stored hashed is also authenticated by the stored hash, as if
+// AllowHashLogin were set. It must not be used for requests from clients, else
+// the stored hash would be as good as the password.
+func (c *CredentialsStore) AAFromNode(username, password, perm string) bool {
+	allowed, _, _ := c.aa(username, password, perm, -1, checkOptions{hashLogin: true})
+	return allowed
+}
+
+// AADryRun is like AAResult, but leaves no trace of the request, so it can be
+// used to ask whether a request would be allowed, for example by tools which
+// review access. Failed checks count towards neither lockout nor the failure
+// rate, Stats and LastLogin are not updated, the hash caches are neither
+// consulted nor filled, stored hashes are not upgraded to RehashCost, and the
+// audit hook is not called. A user who is locked out is still denied. Only the
+// groups resolved by a GroupResolver may be cached, as by HasPerm.
+func (c *CredentialsStore) AADryRun(username, password, perm string) (allowed bool, authenticatedUser string) {
+	allowed, authenticatedUser, _ = c.aa(username, password, perm, -1, checkOptions{dryRun: true})
+	return allowed, authenticatedUser
+}
+
+// aa is like AAResult, but also returns why access was denied: errAnonymous if
+// no username was supplied, the error returned by CheckE if the credentials
+// did not authenticate, ErrStaleAuth if the user's last explicit authentication
+// was too long ago, errNotGranted if the authenticated user lacks the perm, or
+// ErrRequestTooLarge. If size is not negative, a request which
+// would otherwise be allowed is denied if size exceeds the size limit set for
+// username and perm. The credentials are checked as modified by opts.
+func (c *CredentialsStore) aa(username, password, perm string, size int, opts checkOptions) (allowed bool, authenticatedUser string, err error) {
 	// No credential store? Auth is not even enabled.
-	if c == nil {
-		return true
+	if !c.Enabled() {
+		return true, "", nil
+	}
+	c.mu.RLock()
+	username = c.normalize(username)
+	limit, limited := c.sizeLimits[username][perm]
+	maxAge, stepUp := c.recentAuth[perm]
+	c.mu.RUnlock()
+
+	// audit reports the decision to the audit hook, unless this is a dry run.
+	audit := func(allowed bool, reason string) bool {
+		if opts.dryRun {
+			return allowed
+		}
+		return c.audit(username, perm, allowed, reason)
+	}
+
+	// grant allows the request for reason, as principal, unless it is too
+	// large.
+	grant := func(reason, principal string) (bool, string, error) {
+		if size >= 0 && limited && size > limit {
+			return audit(false, AuditReasonSizeLimit), "", ErrRequestTooLarge
+		}
+		return audit(true, reason), principal, nil
 	}
 
 	// Is the required perm granted to all users, including anonymous users?
-	if c.HasAnyPerm(AllUsers, perm, PermAll) {
-		return true
+	if c.allUsersAuthorized(perm, opts) {
+		return grant(AuditReasonAllUsers, "")
 	}
 
 	// At this point a username needs to have been supplied.
-	if username == "" {
-		return false
+	if IsAnonymous(username) {
+		return audit(false, AuditReasonAnonymous), "", errAnonymous
 	}
 
 	// Authenticate the user.
-	if !c.Check(username, password) {
-		return false
+	if ok, err := c.checkE(context.Background(), username, password, opts); !ok {
+		return audit(false, err.Error()), "", err
+	}
+
+	// Has the user explicitly authenticated recently enough, if the perm
+	// requires it?
+	if stepUp && !c.authRecent(username, maxAge) {
+		return audit(false, ErrStaleAuth.Error()), "", ErrStaleAuth
+	}
+
+	// Does the user belong to the tenant, if any?
+	if opts.tenanted && !c.inTenant(opts.tenant, username) {
+		return audit(false, AuditReasonNotGranted), "", errNotGranted
+	}
+
+	// Is the required perm granted to all authenticated users, and not denied
+	// to this one?
+	if c.authedUsersAuthorized(username, perm) {
+		return grant(AuditReasonAuthedUsers, username)
+	}
+
+	// Is the specified user authorized, and not denied the perm? If not, is
+	// the perm still in its grace period?
+	if !c.userAuthorized(username, perm, opts) {
+		if c.inGracePeriod(username, perm) {
+			return grant(AuditReasonGracePeriod, username)
+		}
+		return audit(false, AuditReasonNotGranted), "", errNotGranted
+	}
+	return grant(AuditReasonGranted, username)
+}
+
+// SetPermSizeLimit limits the perm granted to username, such that AAWithSize
+// denies requests for that perm larger than maxBytes. A negative maxBytes
+// removes the limit. By default requests are unlimited in size.
+func (c *CredentialsStore) SetPermSizeLimit(username, perm string, maxBytes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	username = c.normalize(username)
+	if maxBytes < 0 {
+		delete(c.sizeLimits[username], perm)
+		return
+	}
+	if c.sizeLimits == nil {
+		c.sizeLimits = make(map[string]map[string]int)
+	}
+	if c.sizeLimits[username] == nil {
+		c.sizeLimits[username] = make(map[string]int)
+	}
+	c.sizeLimits[username][perm] = maxBytes
+}
+
+// AAWithSize is like AA, but also denies the request if it is larger than the
+// size limit set for username and perm via SetPermSizeLimit. A request denied
+// only for its size is denied with ErrRequestTooLarge, so it can be told apart
+// from one denied for any other reason, for which the error is nil.
+func (c *CredentialsStore) AAWithSize(username, password, perm string, size int) (bool, error) {
+	allowed, _, err := c.aa(username, password, perm, max(size, 0), checkOptions{})
+	if err == ErrRequestTooLarge {
+		return false, err
+	}
+	return allowed, nil
+}
+
+// Dump writes every credential in the store to w, in the JSON format consumed
+// by Load, so that loading the output produces an equivalent store. Passwords
+// are written as stored, hashed or plaintext, unlike when a Credential is
+// marshaled on its own, which redacts them. Credentials are sorted by
+// username, and each credential's perms are sorted.
+func (c *CredentialsStore) Dump(w io.Writer) error {
+	return json.NewEncoder(w).Encode(rawCredentials(c.credentials()))
+}
+
+// credentials returns the contents of the store as a slice of Credentials, sorted
+// by username. The perms of each Credential are also sorted.
+func (c *CredentialsStore) credentials() []Credential {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	usernames := make(map[string]bool, len(c.store)+len(c.perms))
+	for u := range c.store {
+		usernames[u] = true
+	}
+	for u := range c.perms {
+		usernames[u] = true
+	}
+
+	creds := make([]Credential, 0, len(usernames)+len(c.tenantAllUsers))
+	for u := range usernames {
+		var pws []string
+		if len(c.passwords[u]) > 1 {
+			pws = slices.Clone(c.passwords[u][1:])
+		}
+		var expires string
+		if t, ok := c.expires[u]; ok {
+			expires = t.Format(time.RFC3339)
+		}
+		creds = append(creds, Credential{
+			Username:  u,
+			Password:  c.store[u],
+			Passwords: pws,
+			Perms:     c.perms[u].Slice(),
+			Tenant:    c.tenants[u],
+			Deny:      c.denies[u].Slice(),
+			Expires:   expires,
+		})
+	}
+	for t, m := range c.tenantAllUsers {
+		creds = append(creds, Credential{
+			Username: AllUsers,
+			Perms:    m.Slice(),
+			Tenant:   t,
+		})
+	}
+	sort.Slice(creds, func(i, j int) bool {
+		if creds[i].Username != creds[j].Username {
+			return creds[i].Username < creds[j].Username
+		}
+		return creds[i].Tenant < creds[j].Tenant
+	})
+	return creds
+}
+
+// SetLoopbackBypass grants the given perms to any request originating from a
+// loopback address, without requiring any credentials. Calling it with no perms
+// disables the bypass, which is also the default.
+func (c *CredentialsStore) SetLoopbackBypass(perms ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loopbackPerms = make(map[string]bool, len(perms))
+	for _, p := range perms {
+		c.loopbackPerms[p] = true
 	}
+}
 
-	// Is the specified user authorized?
-	return c.HasAnyPerm(username, perm, PermAll)
+// CheckFromAddr is like AA, but first checks if the request came from a loopback
+// address and the perm has been bypassed for such requests via SetLoopbackBypass.
+// remoteAddr may be a host:port pair, as found in http.Request.RemoteAddr, or
+// a bare IP address.
+func (c *CredentialsStore) CheckFromAddr(remoteAddr, username, password, perm string) bool {
+	if !c.Enabled() {
+		return true
+	}
+	c.mu.RLock()
+	bypass := c.loopbackPerms[perm]
+	c.mu.RUnlock()
+	if bypass && isLoopback(remoteAddr) {
+		c.mu.RLock()
+		username = c.normalize(username)
+		c.mu.RUnlock()
+		return c.audit(username, perm, true, AuditReasonLoopback)
+	}
+	return c.AA(username, password, perm)
 }
 
 // HasPermRequest returns true if the username returned by b has the givem perm.
@@ -190,5 +1825,32 @@ func (c *CredentialsStore) AA(username, password, perm string) bool {
 // in the request, it returns false.
 func (c *CredentialsStore) HasPermRequest(b BasicAuther, perm string) bool {
 	username, _, ok := b.BasicAuth()
-	return ok && c.HasPerm(username, perm)
+	if !ok {
+		return c.audit("", perm, false, AuditReasonAnonymous)
+	}
+	c.mu.RLock()
+	username = c.normalize(username)
+	c.mu.RUnlock()
+	if !c.HasPerm(username, perm) {
+		return c.audit(username, perm, false, AuditReasonNotGranted)
+	}
+	return c.audit(username, perm, true, AuditReasonGranted)
+}
+
+// normalize returns username as it is keyed in the store, which is lower-cased
+// if CaseInsensitive is set. AllUsers is returned unchanged.
+func (c *CredentialsStore) normalize(username string) string {
+	if !c.CaseInsensitive || username == AllUsers {
+		return username
+	}
+	return strings.ToLower(username)
+}
+
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
@@ -1,6 +1,9 @@
 package auth
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"strings"
 	"testing"
 )
@@ -33,3 +36,103 @@ func BenchmarkCredentialStore(b *testing.B) {
 		store.CheckRequest(b1)
 	}
 }
+
+// The plaintext benchmarks below should report similar timings, showing that
+// an unknown user can't be distinguished from a wrong password by timing.
+
+func BenchmarkCredentialStoreCheckWrongPassword(b *testing.B) {
+	store := NewCredentialsStore()
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1"}); err != nil {
+		panic("failed to add user")
+	}
+
+	for n := 0; n < b.N; n++ {
+		store.Check("username1", "passwordX")
+	}
+}
+
+func BenchmarkCredentialStoreCheckUnknownUser(b *testing.B) {
+	store := NewCredentialsStore()
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1"}); err != nil {
+		panic("failed to add user")
+	}
+
+	for n := 0; n < b.N; n++ {
+		store.Check("username2", "passwordX")
+	}
+}
+
+// The AA benchmarks below marshal each audit event, as SetAuditFile does, and
+// should report fewer allocations when lean, as the audit hook is then skipped.
+
+func BenchmarkCredentialStoreAAFull(b *testing.B) {
+	benchmarkAA(b, false)
+}
+
+func BenchmarkCredentialStoreAALean(b *testing.B) {
+	benchmarkAA(b, true)
+}
+
+func benchmarkAA(b *testing.B, lean bool) {
+	store := NewCredentialsStore()
+	store.Lean = lean
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1", Perms: []string{PermQuery}}); err != nil {
+		panic("failed to add user")
+	}
+	store.SetAuditHook(func(e AuditEvent) {
+		if _, err := json.Marshal(e); err != nil {
+			panic("failed to marshal audit event")
+		}
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		store.AA("username1", "password1", PermQuery)
+	}
+}
+
+func BenchmarkCredentialStoreLoadJSON(b *testing.B) {
+	store := benchmarkStore(10000)
+	data, err := json.Marshal(rawCredentials(store.credentials()))
+	if err != nil {
+		panic("failed to marshal credentials")
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := NewCredentialsStore().Load(bytes.NewReader(data)); err != nil {
+			panic("failed to load JSON credentials")
+		}
+	}
+}
+
+func BenchmarkCredentialStoreLoadBinary(b *testing.B) {
+	store := benchmarkStore(10000)
+	var buf bytes.Buffer
+	if err := store.SaveBinary(&buf); err != nil {
+		panic("failed to save binary credentials")
+	}
+	data := buf.Bytes()
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := NewCredentialsStore().LoadBinary(bytes.NewReader(data)); err != nil {
+			panic("failed to load binary credentials")
+		}
+	}
+}
+
+func benchmarkStore(n int) *CredentialsStore {
+	perms := []string{PermQuery, PermExecute, PermStatus, PermBackup, PermReady}
+	store := NewCredentialsStore()
+	for i := 0; i < n; i++ {
+		username := fmt.Sprintf("username%d", i)
+		store.store[username] = "$2a$10$fKRHxrEuyDTP6tXIiDycr.nyC8Q7UMIfc31YMyXHDLgRDyhLK3VFS"
+		store.perms[username] = make(PermSet)
+		for j := 0; j <= i%len(perms); j++ {
+			store.perms[username][perms[j]] = true
+		}
+	}
+	return store
+}
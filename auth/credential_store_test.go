@@ -1,9 +1,13 @@
 package auth
 
 import (
+	"bytes"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type testBasicAuther struct {
@@ -42,6 +46,30 @@ func Test_AuthLoadMalformed(t *testing.T) {
 	}
 }
 
+func Test_AuthLoadDuplicate(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "alice", "password": "password1", "perms": ["query"]},
+			{"username": "bob", "password": "password2", "perms": ["query"]},
+			{"username": "*", "perms": ["status"], "tenant": "a"},
+			{"username": "*", "perms": ["status"]},
+			{"username": "alice", "password": "password3", "perms": ["execute"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	err := store.Load(strings.NewReader(jsonStream))
+	if err == nil {
+		t.Fatalf("expected error for duplicate username")
+	}
+	if exp, got := `duplicate username "alice" at index 4`, err.Error(); exp != got {
+		t.Fatalf("wrong error, exp %q, got %q", exp, got)
+	}
+	if _, ok := store.Password("alice"); ok {
+		t.Fatalf("alice loaded despite duplicate")
+	}
+}
+
 func Test_AuthLoadSingle(t *testing.T) {
 	const jsonStream = `
 		[
@@ -153,6 +181,26 @@ func Test_AuthLoadSingleRequest(t *testing.T) {
 	}
 }
 
+func Test_AuthAuthenticateRequest(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(`[{"username": "username1", "password": "password1"}]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	username, ok := store.AuthenticateRequest(&testBasicAuther{username: "username1", password: "password1", ok: true})
+	if !ok || username != "username1" {
+		t.Fatalf("wrong result for correct credentials, got %q, %v", username, ok)
+	}
+	username, ok = store.AuthenticateRequest(&testBasicAuther{username: "username1", password: "wrong", ok: true})
+	if ok || username != "" {
+		t.Fatalf("wrong result for wrong password, got %q, %v", username, ok)
+	}
+	username, ok = store.AuthenticateRequest(&testBasicAuther{username: "username1", password: "password1"})
+	if ok || username != "" {
+		t.Fatalf("wrong result for absent basic auth, got %q, %v", username, ok)
+	}
+}
+
 func Test_AuthPermsLoadSingle(t *testing.T) {
 	const jsonStream = `
 		[
@@ -226,6 +274,262 @@ func Test_AuthPermsAANilStore(t *testing.T) {
 	}
 }
 
+func Test_AuthExpires(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"perms": ["foo"],
+				"expires": "2024-12-31T23:59:59Z"
+			},
+			{
+				"username": "username2",
+				"password": "password2",
+				"perms": ["foo"]
+			}
+		]
+	`
+
+	store := NewCredentialsStore()
+	now := time.Date(2024, 12, 31, 23, 59, 58, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated before expiry")
+	}
+
+	now = now.Add(time.Second)
+	if ok, err := store.CheckE("username1", "password1"); ok || err != ErrExpired {
+		t.Fatalf("expected ErrExpired for username1 at expiry, got %v, %v", ok, err)
+	}
+	if store.AA("username1", "password1", "foo") {
+		t.Fatalf("username1 authorized after expiry")
+	}
+	if ok, err := store.CheckE("username1", "wrong"); ok || err != ErrBadPassword {
+		t.Fatalf("expected ErrBadPassword for expired user with wrong password, got %v, %v", ok, err)
+	}
+	if !store.AA("username2", "password2", "foo") {
+		t.Fatalf("username2 without expiry not authorized")
+	}
+}
+
+func Test_AuthExpiresBad(t *testing.T) {
+	store := NewCredentialsStore()
+	err := store.Load(strings.NewReader(`[{"username": "username1", "password": "password1", "expires": "tomorrow"}]`))
+	if err == nil {
+		t.Fatalf("expected error loading malformed expiry")
+	}
+	if store.Check("username1", "password1") {
+		t.Fatalf("username1 loaded despite malformed expiry")
+	}
+}
+
+func Test_AuthAAResult(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"perms": ["foo"]
+			},
+			{
+				"username": "*",
+				"perms": ["status"]
+			}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	for _, tt := range []struct {
+		username, password, perm string
+		allowed                  bool
+		principal                string
+	}{
+		{"", "", "status", true, ""},
+		{"username1", "password1", "status", true, ""},
+		{"username1", "password1", "foo", true, "username1"},
+		{"username1", "wrong", "foo", false, ""},
+		{"username1", "password1", "bar", false, ""},
+		{"", "", "foo", false, ""},
+	} {
+		allowed, principal := store.AAResult(tt.username, tt.password, tt.perm)
+		if allowed != tt.allowed || principal != tt.principal {
+			t.Fatalf("wrong result for %q/%q/%q, exp %v/%q, got %v/%q", tt.username, tt.password, tt.perm,
+				tt.allowed, tt.principal, allowed, principal)
+		}
+	}
+
+	var nilStore *CredentialsStore
+	if allowed, principal := nilStore.AAResult("username1", "password1", "foo"); !allowed || principal != "" {
+		t.Fatalf("wrong result for nil store, got %v/%q", allowed, principal)
+	}
+}
+
+func Test_AuthAuthedUsers(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"perms": ["remove"]
+			},
+			{
+				"username": "username2",
+				"password": "password2",
+				"deny": ["query"]
+			},
+			{
+				"username": "+",
+				"perms": ["query"]
+			},
+			{
+				"username": "*",
+				"perms": ["status"]
+			}
+		]
+	`
+
+	store := NewCredentialsStore()
+	store.AllowEmptyPassword = true
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	if !store.AA("username1", "password1", "query") {
+		t.Fatalf("username1 not authorized for query via AuthedUsers")
+	}
+	if allowed, principal := store.AAResult("username1", "password1", "query"); !allowed || principal != "username1" {
+		t.Fatalf("wrong principal for AuthedUsers grant, got %v/%q", allowed, principal)
+	}
+	if store.AA("username1", "wrong", "query") {
+		t.Fatalf("username1 authorized for query with wrong password")
+	}
+	if store.AA("", "", "query") {
+		t.Fatalf("anonymous request authorized for query")
+	}
+	if store.AA("+", "", "query") {
+		t.Fatalf("AuthedUsers authenticated as a user")
+	}
+	if store.AA("*", "", "query") {
+		t.Fatalf("AllUsers authenticated as a user")
+	}
+	store.EmptyPasswordMatchesAny = true
+	if store.AA("*", "anything", "query") {
+		t.Fatalf("AllUsers authenticated as a user with EmptyPasswordMatchesAny")
+	}
+	if store.Check("*", "") {
+		t.Fatalf("AllUsers passed Check")
+	}
+	store.EmptyPasswordMatchesAny = false
+	if store.AA("username2", "password2", "query") {
+		t.Fatalf("username2 authorized for denied perm via AuthedUsers")
+	}
+	if store.AA("username2", "password2", "remove") {
+		t.Fatalf("username2 authorized for remove without explicit grant")
+	}
+	if !store.AA("", "", "status") {
+		t.Fatalf("anonymous request not authorized for status via AllUsers")
+	}
+	if exp, got := []string{"username1", "username2"}, store.Users(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong users, exp %v, got %v", exp, got)
+	}
+}
+
+func Test_AuthLoadBadDocument(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"empty", "", "empty credentials document"},
+		{"whitespace", "  \n", "empty credentials document"},
+		{"object", `{}`, "not a JSON array"},
+		{"string", `"username1"`, "not a JSON array"},
+	} {
+		err := NewCredentialsStore().Load(strings.NewReader(tt.doc))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Fatalf("wrong error loading %s document, exp %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func Test_AuthLoadBadUsername(t *testing.T) {
+	for _, tt := range []struct {
+		username string
+		want     string
+	}{
+		{"user:name", "contains a colon"},
+		{`user\u0000name`, "contains a control character"},
+		{`user\nname`, "contains a control character"},
+		{" username1", "leading or trailing whitespace"},
+		{`username1\u00a0`, "leading or trailing whitespace"},
+	} {
+		doc := `[{"username": "` + tt.username + `", "password": "password1"}]`
+		err := NewCredentialsStore().Load(strings.NewReader(doc))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Fatalf("wrong error loading username %q, exp %q, got %v", tt.username, tt.want, err)
+		}
+	}
+
+	store := NewCredentialsStore()
+	if err := store.AddUser(Credential{Username: "user:name", Password: "password1"}); err == nil {
+		t.Fatalf("expected error adding user with colon in username")
+	}
+	if err := store.Load(strings.NewReader(`[
+		{"username": "*", "perms": ["status"]},
+		{"username": "+", "perms": ["query"]},
+		{"username": "group:admins", "perms": ["all"]},
+		{"username": "user name", "password": "password1"}
+	]`)); err != nil {
+		t.Fatalf("failed to load valid usernames: %s", err.Error())
+	}
+}
+
+func Test_AuthLoadRequireNonEmpty(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(`[]`)); err != nil {
+		t.Fatalf("failed to load empty array: %s", err.Error())
+	}
+
+	store.RequireNonEmpty = true
+	if err := store.Load(strings.NewReader(`[]`)); err != ErrNoCredentials {
+		t.Fatalf("expected ErrNoCredentials loading empty array, got %v", err)
+	}
+	if err := store.Load(strings.NewReader(`[{"username": "username1", "password": "password1"}]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	if err := store.Reload(strings.NewReader(`[]`)); err != ErrNoCredentials {
+		t.Fatalf("expected ErrNoCredentials reloading empty array, got %v", err)
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 removed by failed reload")
+	}
+}
+
+func Test_AuthEnabled(t *testing.T) {
+	var store *CredentialsStore
+	if store.Enabled() {
+		t.Fatalf("nil store reports auth enabled")
+	}
+	if !NewCredentialsStore().Enabled() {
+		t.Fatalf("non-nil store reports auth disabled")
+	}
+}
+
+func Test_AuthIsAnonymous(t *testing.T) {
+	if !IsAnonymous("") {
+		t.Fatalf("empty username not anonymous")
+	}
+	if IsAnonymous("username1") {
+		t.Fatalf("username1 reported as anonymous")
+	}
+}
+
 func Test_AuthPermsAA(t *testing.T) {
 	const jsonStream = `
 		[
@@ -338,6 +642,35 @@ func Test_AuthPermsRequestLoadSingle(t *testing.T) {
 	}
 }
 
+func Test_AuthNewCredentialsStoreFromJSON(t *testing.T) {
+	store, err := NewCredentialsStoreFromJSON([]byte(`[{"username": "username1", "password": "password1", "perms": ["foo"]}]`))
+	if err != nil {
+		t.Fatalf("failed to create store from JSON: %s", err.Error())
+	}
+	if !store.AA("username1", "password1", "foo") {
+		t.Fatalf("username1 not authorized")
+	}
+
+	if _, err := NewCredentialsStoreFromJSON([]byte(`[{`)); err == nil {
+		t.Fatalf("expected error creating store from bad JSON")
+	}
+}
+
+func Test_AuthNewCredentialsStoreFromEnv(t *testing.T) {
+	t.Setenv("RQLITE_TEST_AUTH", `[{"username": "username1", "password": "password1", "perms": ["foo"]}]`)
+	store, err := NewCredentialsStoreFromEnv("RQLITE_TEST_AUTH")
+	if err != nil {
+		t.Fatalf("failed to create store from env: %s", err.Error())
+	}
+	if !store.AA("username1", "password1", "foo") {
+		t.Fatalf("username1 not authorized")
+	}
+
+	if _, err := NewCredentialsStoreFromEnv("RQLITE_TEST_AUTH_NOT_SET"); err == nil {
+		t.Fatalf("expected error for unset environment variable")
+	}
+}
+
 func Test_AuthPermsRequestLoadSingleFromFile(t *testing.T) {
 	const jsonStream = `
 		[
@@ -481,6 +814,1056 @@ func Test_AuthPermsAllUsers(t *testing.T) {
 	}
 }
 
+func Test_AuthLoadInvertedPerms(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "alice", "password": "password1", "perms": ["status"]},
+			{"username": "bob", "password": "password2"}
+		]
+	`
+	const permsStream = `
+		{
+			"execute": ["alice", "bob"],
+			"query": ["alice"],
+			"ready": ["*"]
+		}
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	if err := store.LoadInvertedPerms(strings.NewReader(permsStream)); err != nil {
+		t.Fatalf("failed to load inverted perms: %s", err.Error())
+	}
+
+	if !store.Check("alice", "password1") || !store.Check("bob", "password2") {
+		t.Fatalf("passwords affected by loading inverted perms")
+	}
+	for _, p := range []string{PermStatus, PermExecute, PermQuery, PermReady} {
+		if !store.HasPerm("alice", p) {
+			t.Fatalf("alice does not have %s perm", p)
+		}
+	}
+	if !store.HasPerm("bob", PermExecute) {
+		t.Fatalf("bob does not have execute perm")
+	}
+	if store.HasPerm("bob", PermQuery) {
+		t.Fatalf("bob has query perm")
+	}
+	if !store.HasPerm("bob", PermReady) {
+		t.Fatalf("bob does not have ready perm via *")
+	}
+
+	if err := store.LoadInvertedPerms(strings.NewReader(`["execute"]`)); err == nil {
+		t.Fatalf("expected error loading non-object inverted perms")
+	}
+}
+
+func Test_AuthLoadInvertedPermsRejected(t *testing.T) {
+	store := NewCredentialsStore()
+	store.StrictPerms = true
+	for _, tt := range []struct {
+		perms string
+		err   string
+	}{
+		{`{"query": ["alice", "ev:il"]}`, "contains a colon"},
+		{`{"query": [""]}`, `empty username for perm "query"`},
+		{`{"nosuchperm": ["alice"]}`, `unknown perm "nosuchperm"`},
+	} {
+		err := store.LoadInvertedPerms(strings.NewReader(tt.perms))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("wrong error loading %s, exp %q, got %v", tt.perms, tt.err, err)
+		}
+		if len(store.Users()) != 0 {
+			t.Fatalf("store modified by rejected inverted perms %s", tt.perms)
+		}
+	}
+}
+
+func Test_AuthReplaceAll(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username1", "password": "password1", "perms": ["foo"]},
+			{"username": "username2", "password": "password2", "perms": ["bar"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	err := store.ReplaceAll([]Credential{
+		{Username: "username2", Password: "password2new", Perms: []string{"baz"}},
+		{Username: "username3", Password: "password3", Perms: []string{"qux"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to replace credentials: %s", err.Error())
+	}
+
+	if _, ok := store.Password("username1"); ok {
+		t.Fatalf("username1 not removed")
+	}
+	if store.HasPerm("username1", "foo") {
+		t.Fatalf("username1 still has foo perm")
+	}
+	if store.Check("username2", "password2") {
+		t.Fatalf("username2 authenticated with old password")
+	}
+	if !store.Check("username2", "password2new") {
+		t.Fatalf("username2 not authenticated with new password")
+	}
+	if store.HasPerm("username2", "bar") || !store.HasPerm("username2", "baz") {
+		t.Fatalf("username2 perms not updated")
+	}
+	if !store.Check("username3", "password3") || !store.HasPerm("username3", "qux") {
+		t.Fatalf("username3 not added")
+	}
+
+	// Invalid credential sets must leave the store untouched.
+	for _, creds := range [][]Credential{
+		{{Username: "username4", Password: "password4"}, {Username: "", Password: "password5"}},
+		{{Username: "username4", Password: "password4"}, {Username: "username4", Password: "password5"}},
+	} {
+		if err := store.ReplaceAll(creds); err == nil {
+			t.Fatalf("expected error replacing with %v", creds)
+		}
+		if _, ok := store.Password("username4"); ok {
+			t.Fatalf("store modified by invalid replace")
+		}
+		if !store.Check("username3", "password3") {
+			t.Fatalf("username3 removed by invalid replace")
+		}
+	}
+}
+
+func Test_AuthReload(t *testing.T) {
+	const jsonStream1 = `
+		[
+			{"username": "username1", "password": "password1", "perms": ["foo"]},
+			{"username": "username2", "password": "password2", "perms": ["bar"]},
+			{"username": "*", "perms": ["qux"]}
+		]
+	`
+	const jsonStream2 = `
+		[
+			{"username": "username2", "password": "password2new", "perms": ["baz"]},
+			{"username": "username3", "password": "password3", "perms": ["foo"]}
+		]
+	`
+
+	path := mustWriteTempFile(t, jsonStream1)
+	store, err := NewCredentialsStoreFromFile(path)
+	if err != nil {
+		t.Fatalf("failed to load credential store from file: %s", err.Error())
+	}
+
+	if err := os.WriteFile(path, []byte(jsonStream2), 0600); err != nil {
+		t.Fatalf("failed to write credentials file: %s", err.Error())
+	}
+	if err := store.ReloadFromFile(path); err != nil {
+		t.Fatalf("failed to reload credentials: %s", err.Error())
+	}
+
+	if store.Check("username1", "password1") {
+		t.Fatalf("removed username1 still authenticated")
+	}
+	if store.Check("username2", "password2") || !store.Check("username2", "password2new") {
+		t.Fatalf("username2 password not updated")
+	}
+	if store.HasPerm("username2", "bar") || !store.HasPerm("username2", "baz") {
+		t.Fatalf("username2 perms not updated")
+	}
+	if !store.Check("username3", "password3") || !store.HasPerm("username3", "foo") {
+		t.Fatalf("username3 not added")
+	}
+	if store.HasPerm("username3", "qux") {
+		t.Fatalf("removed * perms still granted")
+	}
+
+	// A malformed reload leaves the store untouched.
+	if err := store.Reload(strings.NewReader(`[{"username": "username4"`)); err == nil {
+		t.Fatalf("expected error reloading malformed credentials")
+	}
+	if !store.Check("username3", "password3") {
+		t.Fatalf("store modified by malformed reload")
+	}
+
+	if err := store.ReloadFromFile(path + "-nonexistent"); err == nil {
+		t.Fatalf("expected error reloading from nonexistent file")
+	}
+}
+
+func Test_AuthConcurrentLoad(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username1", "password": "password1", "perms": ["foo"]},
+			{"username": "username2", "password": "password2", "perms": ["bar"]},
+			{"username": "*", "perms": ["qux"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := &testBasicAuther{username: "username1", password: "password1", ok: true}
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if !store.Check("username1", "password1") {
+					t.Errorf("username1 not authenticated during concurrent load")
+					return
+				}
+				if !store.AA("username2", "password2", "bar") {
+					t.Errorf("username2 not authorized during concurrent load")
+					return
+				}
+				store.HasPerm("username1", "qux")
+				store.HasPermRequest(b, "foo")
+				store.CheckRequest(b)
+				store.Password("username2")
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+			t.Fatalf("failed to load credentials: %s", err.Error())
+		}
+		if err := store.Reload(strings.NewReader(jsonStream)); err != nil {
+			t.Fatalf("failed to reload credentials: %s", err.Error())
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func Test_AuthDump(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username2", "password": "$2a$10$fKRHxrEuyDTP6tXIiDycr.nyC8Q7UMIfc31YMyXHDLgRDyhLK3VFS", "perms": ["foo"]},
+			{"username": "username1", "password": "password1", "perms": ["qux", "bar"]},
+			{"username": "username3", "password": "password3"},
+			{"username": "*", "perms": ["abc"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	var buf bytes.Buffer
+	if err := store.Dump(&buf); err != nil {
+		t.Fatalf("failed to dump credentials: %s", err.Error())
+	}
+	exp := `[{"username":"*","perms":["abc"]},` +
+		`{"username":"username1","password":"password1","perms":["bar","qux"]},` +
+		`{"username":"username2","password":"$2a$10$fKRHxrEuyDTP6tXIiDycr.nyC8Q7UMIfc31YMyXHDLgRDyhLK3VFS","perms":["foo"]},` +
+		`{"username":"username3","password":"password3"}]` + "\n"
+	if got := buf.String(); got != exp {
+		t.Fatalf("wrong dump, exp %s, got %s", exp, got)
+	}
+
+	loaded := NewCredentialsStore()
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatalf("failed to load dumped credentials: %s", err.Error())
+	}
+	if !reflect.DeepEqual(store.credentials(), loaded.credentials()) {
+		t.Fatalf("dump round trip mismatch, exp %v, got %v", store.credentials(), loaded.credentials())
+	}
+
+	var empty bytes.Buffer
+	if err := NewCredentialsStore().Dump(&empty); err != nil {
+		t.Fatalf("failed to dump empty store: %s", err.Error())
+	}
+	if got := empty.String(); got != "[]\n" {
+		t.Fatalf("wrong dump of empty store, got %s", got)
+	}
+}
+
+func Test_AuthUpsert(t *testing.T) {
+	store := NewCredentialsStore()
+
+	for _, cred := range []Credential{
+		{Username: "username1", Password: "password1", Perms: []string{"foo"}},
+		{Username: "username2", Password: "password2", Perms: []string{"bar"}},
+		{Username: "username1", Password: "password1new", Perms: []string{"baz", "qux"}},
+		{Username: AllUsers, Perms: []string{"abc"}},
+	} {
+		if err := store.Upsert(cred); err != nil {
+			t.Fatalf("failed to upsert %s: %s", cred.Username, err.Error())
+		}
+	}
+
+	if store.Check("username1", "password1") {
+		t.Fatalf("username1 authenticated with old password")
+	}
+	if !store.Check("username1", "password1new") {
+		t.Fatalf("username1 not authenticated with new password")
+	}
+	if store.HasPerm("username1", "foo") {
+		t.Fatalf("username1 still has foo perm")
+	}
+	if !store.HasPerm("username1", "baz") || !store.HasPerm("username1", "qux") {
+		t.Fatalf("username1 perms not updated")
+	}
+	if !store.Check("username2", "password2") || !store.HasPerm("username2", "bar") {
+		t.Fatalf("username2 not added correctly")
+	}
+	if !store.HasPerm("username2", "abc") {
+		t.Fatalf("username2 does not have abc perm via *")
+	}
+
+	if err := store.Upsert(Credential{Password: "password3"}); err == nil {
+		t.Fatalf("expected error upserting credential with empty username")
+	}
+}
+
+func Test_AuthAddRemoveUser(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1", Perms: []string{"foo"}}); err != nil {
+		t.Fatalf("failed to add username1: %s", err.Error())
+	}
+	if err := store.AddUser(Credential{Username: "username2", Password: "password2", Perms: []string{"bar"}}); err != nil {
+		t.Fatalf("failed to add username2: %s", err.Error())
+	}
+	if !store.AA("username1", "password1", "foo") {
+		t.Fatalf("username1 not authorized for foo")
+	}
+
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1new", Perms: []string{"baz"}}); err != nil {
+		t.Fatalf("failed to update username1: %s", err.Error())
+	}
+	if store.Check("username1", "password1") || !store.AA("username1", "password1new", "baz") {
+		t.Fatalf("username1 not updated")
+	}
+
+	if err := store.AddUser(Credential{Password: "password3"}); err == nil {
+		t.Fatalf("expected error adding user with empty username")
+	}
+
+	if !store.RemoveUser("username1") {
+		t.Fatalf("RemoveUser returned false for existing user")
+	}
+	if store.Check("username1", "password1new") || store.HasPerm("username1", "baz") {
+		t.Fatalf("username1 not removed")
+	}
+	if store.RemoveUser("username1") {
+		t.Fatalf("RemoveUser returned true for removed user")
+	}
+	if !store.Check("username2", "password2") {
+		t.Fatalf("username2 affected by removal of username1")
+	}
+}
+
+func Test_AuthEmptyPassword(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username1", "perms": ["foo"]},
+			{"username": "username2", "password": "password2", "perms": ["foo"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	// By default a user with an empty password can never authenticate.
+	if store.Check("username1", "") {
+		t.Fatalf("username1 with empty password authenticated by default")
+	}
+	if store.AA("username1", "", "foo") {
+		t.Fatalf("username1 with empty password authorized by default")
+	}
+
+	store.AllowEmptyPassword = true
+	if !store.Check("username1", "") {
+		t.Fatalf("username1 not authenticated with empty password")
+	}
+	if store.Check("username1", "anything") {
+		t.Fatalf("username1 authenticated with non-empty password")
+	}
+
+	store.EmptyPasswordMatchesAny = true
+	if !store.Check("username1", "") || !store.Check("username1", "anything") {
+		t.Fatalf("username1 not authenticated with any password")
+	}
+	if !store.AA("username1", "anything", "foo") {
+		t.Fatalf("username1 not authorized with any password")
+	}
+
+	// Users with a password are unaffected.
+	if store.Check("username2", "") || store.Check("username2", "anything") {
+		t.Fatalf("username2 authenticated with wrong password")
+	}
+	if !store.Check("username2", "password2") {
+		t.Fatalf("username2 not authenticated")
+	}
+}
+
+func Test_AuthPermSizeLimit(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username1", "password": "password1", "perms": ["execute"]},
+			{"username": "username2", "password": "password2", "perms": ["execute"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	if ok, err := store.AAWithSize("username1", "password1", PermExecute, 1<<20); !ok || err != nil {
+		t.Fatalf("username1 not authorized with no size limit, got %v, %v", ok, err)
+	}
+
+	store.SetPermSizeLimit("username1", PermExecute, 100)
+	if ok, err := store.AAWithSize("username1", "password1", PermExecute, 100); !ok || err != nil {
+		t.Fatalf("username1 not authorized under size limit, got %v, %v", ok, err)
+	}
+	if ok, err := store.AAWithSize("username1", "password1", PermExecute, 101); ok || err != ErrRequestTooLarge {
+		t.Fatalf("username1 not denied as too large over size limit, got %v, %v", ok, err)
+	}
+	if ok, err := store.AAWithSize("username1", "wrong", PermExecute, 101); ok || err != nil {
+		t.Fatalf("wrong result with wrong password over size limit, got %v, %v", ok, err)
+	}
+	if ok, err := store.AAWithSize("username1", "password1", PermQuery, 101); ok || err != nil {
+		t.Fatalf("wrong result for perm not granted, got %v, %v", ok, err)
+	}
+	if ok, _ := store.AAWithSize("username2", "password2", PermExecute, 101); !ok {
+		t.Fatalf("username2 affected by username1 size limit")
+	}
+
+	store.SetPermSizeLimit("username1", PermExecute, -1)
+	if ok, _ := store.AAWithSize("username1", "password1", PermExecute, 101); !ok {
+		t.Fatalf("username1 not authorized after size limit removed")
+	}
+
+	var nilStore *CredentialsStore
+	if ok, _ := nilStore.AAWithSize("username1", "password1", PermExecute, 101); !ok {
+		t.Fatalf("nil store didn't authorize")
+	}
+}
+
+func Test_AuthCacheInfo(t *testing.T) {
+	store := NewCredentialsStore()
+	if info := store.CacheInfo(); !info.Enabled || info.NegativeCache != nil ||
+		info.Cache.Capacity != DefaultHashCacheSize || info.Cache.Shards != DefaultHashCacheShards {
+		t.Fatalf("wrong default cache info, got %+v", info)
+	}
+	store.UseCache = false
+	if store.CacheInfo().Enabled {
+		t.Fatalf("cache reported enabled with UseCache unset")
+	}
+
+	store.UseCache = true
+	store.SetHashCache(NewHashCacheWithSize(100, WithTTL(time.Hour)))
+	store.SetNegativeHashCache(NewHashCacheWithSize(10, WithTTL(time.Minute)))
+	if err := store.AddUser(Credential{Username: "username1", Password: mustBcrypt(t, "password1")}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	store.Check("username1", "password1")
+	store.Check("username1", "wrong")
+
+	info := store.CacheInfo()
+	if !info.Enabled {
+		t.Fatalf("cache not reported enabled")
+	}
+	if exp := (HashCacheConfig{Capacity: 100, TTL: time.Hour, Policy: HashCachePolicyLRU, Shards: 1, Len: 1}); info.Cache != exp {
+		t.Fatalf("wrong cache config, exp %+v, got %+v", exp, info.Cache)
+	}
+	if exp := (HashCacheConfig{Capacity: 10, TTL: time.Minute, Policy: HashCachePolicyLRU, Shards: 1, Len: 1}); info.NegativeCache == nil || *info.NegativeCache != exp {
+		t.Fatalf("wrong negative cache config, exp %+v, got %+v", exp, info.NegativeCache)
+	}
+}
+
+func Test_AuthAADryRun(t *testing.T) {
+	store := NewCredentialsStore()
+	hash := mustBcrypt(t, "password1")
+	if err := store.Load(strings.NewReader(`[
+		{"username": "username1", "password": "` + hash + `", "perms": ["query"]},
+		{"username": "username2", "password": "password2", "perms": ["query"]}
+	]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	store.RehashCost = 5
+	store.SetNegativeHashCache(NewHashCache())
+	store.SetLockoutPolicy(&LockoutPolicy{MaxFailures: 1, Window: time.Minute, Duration: time.Hour})
+	store.SetFailureRateLimit(1, time.Minute)
+	audited := 0
+	store.SetAuditHook(func(AuditEvent) { audited++ })
+
+	if allowed, principal := store.AADryRun("username1", "password1", PermQuery); !allowed || principal != "username1" {
+		t.Fatalf("wrong dry run result for correct password, got %v/%q", allowed, principal)
+	}
+	if allowed, _ := store.AADryRun("username1", "password1", PermExecute); allowed {
+		t.Fatalf("dry run allowed perm not granted")
+	}
+	for i := 0; i < 3; i++ {
+		if allowed, _ := store.AADryRun("username1", "wrong", PermQuery); allowed {
+			t.Fatalf("dry run allowed wrong password")
+		}
+	}
+
+	if store.IsLockedOut("username1") {
+		t.Fatalf("dry run triggered lockout")
+	}
+	if store.Overloaded() {
+		t.Fatalf("dry run counted towards failure rate")
+	}
+	if _, ok := store.LastLogin("username1"); ok {
+		t.Fatalf("dry run recorded a login")
+	}
+	if exp, got := (Stats{}), store.Stats(); exp != got {
+		t.Fatalf("dry run changed stats, got %+v", got)
+	}
+	if store.hashCache.Len() != 0 || store.negHashCache.Len() != 0 {
+		t.Fatalf("dry run filled hash caches")
+	}
+	if pw, _ := store.Password("username1"); pw != hash {
+		t.Fatalf("dry run rehashed stored password")
+	}
+	if audited != 0 {
+		t.Fatalf("dry run called audit hook %d times", audited)
+	}
+
+	// A real failure locks username2 out, which a dry run must respect.
+	store.AA("username2", "wrong", PermQuery)
+	if allowed, _ := store.AADryRun("username2", "password2", PermQuery); allowed {
+		t.Fatalf("dry run allowed locked out user")
+	}
+}
+
+func Test_AuthGate(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username1", "password": "password1", "perms": ["foo"]},
+			{"username": "username2", "password": "password2", "perms": ["foo"]},
+			{"username": "*", "perms": ["bar"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	store.SetAuthGate(func(username string) bool {
+		return username != "username1"
+	})
+	if store.Check("username1", "password1") {
+		t.Fatalf("gated username1 authenticated")
+	}
+	if store.AA("username1", "password1", "foo") {
+		t.Fatalf("gated username1 authorized for foo")
+	}
+	if !store.AA("username1", "password1", "bar") {
+		t.Fatalf("gated username1 not authorized for bar granted to all users")
+	}
+	if !store.Check("username2", "password2") {
+		t.Fatalf("username2 not authenticated")
+	}
+	if store.Check("username2", "wrong") {
+		t.Fatalf("username2 authenticated with wrong password")
+	}
+
+	store.SetAuthGate(nil)
+	if !store.AA("username1", "password1", "foo") {
+		t.Fatalf("username1 not authorized for foo after gate removed")
+	}
+}
+
+func Test_AuthPermsWithPrefix(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username1", "password": "password1", "perms": ["db:query", "db:execute", "status", "dbx"]},
+			{"username": "username2", "password": "password2", "perms": ["status"]},
+			{"username": "*", "perms": ["db:ready", "ready"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	if exp, got := []string{"db:execute", "db:query", "db:ready"}, store.PermsWithPrefix("username1", "db:"); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong perms for username1, exp %v, got %v", exp, got)
+	}
+	if exp, got := []string{"db:ready"}, store.PermsWithPrefix("username2", "db:"); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong perms for username2, exp %v, got %v", exp, got)
+	}
+	if got := store.PermsWithPrefix("username2", "backup"); got != nil {
+		t.Fatalf("expected no perms for username2, got %v", got)
+	}
+	if exp, got := []string{"db:ready", "ready", "status"}, store.PermsWithPrefix("username2", ""); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong perms for username2 with empty prefix, exp %v, got %v", exp, got)
+	}
+}
+
+func Test_AuthDetectDefaultCredentials(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "admin", "password": "admin", "perms": ["all"]},
+			{"username": "root", "password": "s3cr3t!", "perms": ["all"]},
+			{"username": "rqlite", "password": "rqlite", "perms": ["query"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	store.SetAuthGate(func(string) bool { return false })
+
+	defaults := []Credential{
+		{Username: "rqlite", Password: "rqlite"},
+		{Username: "admin", Password: "password"},
+		{Username: "admin", Password: "admin"},
+		{Username: "root", Password: "root"},
+		{Username: "guest", Password: "guest"},
+	}
+	if exp, got := []string{"admin", "rqlite"}, store.DetectDefaultCredentials(defaults); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong default credentials detected, exp %v, got %v", exp, got)
+	}
+
+	if err := store.Upsert(Credential{Username: "admin", Password: "changed", Perms: []string{"all"}}); err != nil {
+		t.Fatalf("failed to upsert admin: %s", err.Error())
+	}
+	if exp, got := []string{"rqlite"}, store.DetectDefaultCredentials(defaults); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong default credentials detected after change, exp %v, got %v", exp, got)
+	}
+
+	// Detection leaves no trace.
+	hashed := mustBcrypt(t, "admin")
+	store = NewCredentialsStore()
+	store.UseCache = true
+	store.RehashCost = 5
+	if err := store.AddUser(Credential{Username: "admin", Password: hashed}); err != nil {
+		t.Fatalf("failed to add admin: %s", err.Error())
+	}
+	if exp, got := []string{"admin"}, store.DetectDefaultCredentials(defaults); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong default credentials detected for hash, exp %v, got %v", exp, got)
+	}
+	if (store.Stats() != Stats{}) {
+		t.Fatalf("detection updated stats: %+v", store.Stats())
+	}
+	if store.hashCache.Len() != 0 {
+		t.Fatalf("detection filled hash cache")
+	}
+	if pw, _ := store.Password("admin"); pw != hashed {
+		t.Fatalf("detection rehashed admin")
+	}
+}
+
+func Test_AuthLoopbackBypass(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"perms": ["execute"]
+			}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	// Bypass is off by default.
+	if store.CheckFromAddr("127.0.0.1:4001", "", "", PermQuery) {
+		t.Fatalf("loopback request authorized for query with no bypass set")
+	}
+
+	store.SetLoopbackBypass(PermQuery, PermStatus)
+	for _, addr := range []string{"127.0.0.1:4001", "[::1]:4001", "127.0.0.1", "::1"} {
+		if !store.CheckFromAddr(addr, "", "", PermQuery) {
+			t.Fatalf("loopback request from %s not authorized for query", addr)
+		}
+		if !store.CheckFromAddr(addr, "", "", PermStatus) {
+			t.Fatalf("loopback request from %s not authorized for status", addr)
+		}
+		if store.CheckFromAddr(addr, "", "", PermExecute) {
+			t.Fatalf("loopback request from %s authorized for execute", addr)
+		}
+	}
+
+	for _, addr := range []string{"192.168.0.1:4001", "[2001:db8::1]:4001", "localhost:4001", ""} {
+		if store.CheckFromAddr(addr, "", "", PermQuery) {
+			t.Fatalf("request from %s authorized for query", addr)
+		}
+	}
+
+	// Credentials are still honored for non-bypassed perms.
+	if !store.CheckFromAddr("192.168.0.1:4001", "username1", "password1", PermExecute) {
+		t.Fatalf("username1 not authorized for execute")
+	}
+	if store.CheckFromAddr("127.0.0.1:4001", "username1", "wrong", PermExecute) {
+		t.Fatalf("username1 authorized for execute with wrong password")
+	}
+
+	store.SetLoopbackBypass()
+	if store.CheckFromAddr("127.0.0.1:4001", "", "", PermQuery) {
+		t.Fatalf("loopback request authorized for query after bypass cleared")
+	}
+}
+
+func Test_AuthInheritedPerms(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username1", "password": "password1", "perms": ["foo", "bar"]},
+			{"username": "username2", "password": "password2", "perms": ["baz"]},
+			{"username": "*", "perms": ["bar", "qux", "abc"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	if exp, got := []string{"abc", "qux"}, store.InheritedPerms("username1"); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong inherited perms for username1, exp %v, got %v", exp, got)
+	}
+	if exp, got := []string{"abc", "bar", "qux"}, store.InheritedPerms("username2"); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong inherited perms for username2, exp %v, got %v", exp, got)
+	}
+	if exp, got := []string{"abc", "bar", "qux"}, store.InheritedPerms("nonexistent"); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong inherited perms for nonexistent, exp %v, got %v", exp, got)
+	}
+	if got := store.InheritedPerms(AllUsers); got != nil {
+		t.Fatalf("expected no inherited perms for *, got %v", got)
+	}
+
+	// Denied perms are not inherited, nor are perms granted via a wildcard.
+	store = NewCredentialsStore()
+	if err := store.Load(strings.NewReader(`[
+		{"username": "username1", "password": "password1", "perms": ["query:*"], "deny": ["status"]},
+		{"username": "*", "perms": ["query:a", "status", "ready"]}
+	]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	if exp, got := []string{"ready"}, store.InheritedPerms("username1"); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong inherited perms for username1, exp %v, got %v", exp, got)
+	}
+
+	store = NewCredentialsStore()
+	if err := store.Load(strings.NewReader(`[{"username": "username1", "password": "password1", "perms": ["foo"]}]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	if got := store.InheritedPerms("username1"); got != nil {
+		t.Fatalf("expected no inherited perms without *, got %v", got)
+	}
+}
+
+func Test_AuthCaseInsensitive(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "Alice", "password": "password1", "perms": ["query"]},
+			{"username": "*", "perms": ["status"]}
+		]
+	`
+
+	for _, ci := range []bool{false, true} {
+		store := NewCredentialsStore()
+		store.CaseInsensitive = ci
+		if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+			t.Fatalf("failed to load credentials: %s", err.Error())
+		}
+
+		for _, u := range []string{"alice", "ALICE"} {
+			if got := store.Check(u, "password1"); got != ci {
+				t.Fatalf("Check(%q) = %v with CaseInsensitive %v", u, got, ci)
+			}
+			if got := store.HasPerm(u, PermQuery); got != ci {
+				t.Fatalf("HasPerm(%q) = %v with CaseInsensitive %v", u, got, ci)
+			}
+			if _, got := store.Password(u); got != ci {
+				t.Fatalf("Password(%q) found = %v with CaseInsensitive %v", u, got, ci)
+			}
+			if got := store.AA(u, "password1", PermQuery); got != ci {
+				t.Fatalf("AA(%q) = %v with CaseInsensitive %v", u, got, ci)
+			}
+		}
+		if !store.Check("Alice", "password1") {
+			t.Fatalf("Alice not authenticated with CaseInsensitive %v", ci)
+		}
+		if !store.HasPerm(AllUsers, PermStatus) {
+			t.Fatalf("* does not have status with CaseInsensitive %v", ci)
+		}
+	}
+}
+
+func Test_AuthCaseInsensitiveGate(t *testing.T) {
+	store := NewCredentialsStore()
+	store.CaseInsensitive = true
+	if err := store.Load(strings.NewReader(`[{"username": "Admin", "password": "password1", "perms": ["all"]}]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	store.SetAuthGate(func(username string) bool {
+		return username != "admin"
+	})
+	var events []AuditEvent
+	store.SetAuditHook(func(e AuditEvent) {
+		events = append(events, e)
+	})
+
+	for _, u := range []string{"admin", "Admin", "ADMIN"} {
+		if ok, err := store.CheckE(u, "password1"); ok || err != ErrDeniedByGate {
+			t.Fatalf("gate bypassed by %q, got %v, %v", u, ok, err)
+		}
+	}
+	store.AA("ADMIN", "password1", PermQuery)
+	if len(events) != 1 || events[0].Username != "admin" {
+		t.Fatalf("audit event not for normalized username, got %v", events)
+	}
+
+	store.SetAuthGate(nil)
+	username, ok := store.AuthenticateRequest(&testBasicAuther{username: "ADMIN", password: "password1", ok: true})
+	if !ok || username != "admin" {
+		t.Fatalf("wrong result authenticating ADMIN, got %q, %v", username, ok)
+	}
+	if _, principal := store.AAResult("ADMIN", "password1", PermQuery); principal != "admin" {
+		t.Fatalf("wrong principal for ADMIN, got %q", principal)
+	}
+}
+
+func Test_AuthUsersPerms(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "bob", "password": "password2", "perms": ["execute", "query"]},
+			{"username": "alice", "password": "password1", "perms": ["query"]},
+			{"username": "*", "perms": ["status"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if exp, got := []string{}, store.Users(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong users for empty store, exp %v, got %v", exp, got)
+	}
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	if err := store.LoadInvertedPerms(strings.NewReader(`{"backup": ["carol"]}`)); err != nil {
+		t.Fatalf("failed to load inverted perms: %s", err.Error())
+	}
+
+	users := store.Users()
+	if exp := []string{"alice", "bob", "carol"}; !reflect.DeepEqual(exp, users) {
+		t.Fatalf("wrong users, exp %v, got %v", exp, users)
+	}
+	users[0] = "mallory"
+	if store.Users()[0] != "alice" {
+		t.Fatalf("Users did not return a copy")
+	}
+
+	for _, tt := range []struct {
+		username string
+		exp      []string
+	}{
+		{"alice", []string{"query", "status"}},
+		{"bob", []string{"execute", "query", "status"}},
+		{"carol", []string{"backup", "status"}},
+		{"nobody", []string{"status"}},
+		{AllUsers, []string{"status"}},
+	} {
+		if got := store.Perms(tt.username); !reflect.DeepEqual(tt.exp, got) {
+			t.Fatalf("wrong perms for %s, exp %v, got %v", tt.username, tt.exp, got)
+		}
+	}
+}
+
+func Test_AuthMultiplePasswords(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username1", "password": "password1", "passwords": ["password2"]},
+			{"username": "username2", "passwords": ["password3", "password4"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	for _, tt := range []struct {
+		username string
+		password string
+		exp      bool
+	}{
+		{"username1", "password1", true},
+		{"username1", "password2", true},
+		{"username1", "password3", false},
+		{"username2", "password3", true},
+		{"username2", "password4", true},
+		{"username2", "", false},
+	} {
+		if got := store.Check(tt.username, tt.password); got != tt.exp {
+			t.Fatalf("Check(%q, %q) = %v, exp %v", tt.username, tt.password, got, tt.exp)
+		}
+	}
+	if pw, _ := store.Password("username2"); pw != "password3" {
+		t.Fatalf("wrong password for username2, exp password3, got %s", pw)
+	}
+
+	// Completing the rotation removes the old password.
+	if err := store.Upsert(Credential{Username: "username1", Password: "password2"}); err != nil {
+		t.Fatalf("failed to upsert: %s", err.Error())
+	}
+	if store.Check("username1", "password1") || !store.Check("username1", "password2") {
+		t.Fatalf("old password still valid after rotation")
+	}
+}
+
+func Test_AuthSnapshot(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "alice", "password": "password1", "perms": ["query", "remove"], "deny": ["remove"]},
+			{"username": "bob", "password": "password2", "perms": ["execute"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if exp, got := map[string][]string{AllUsers: nil}, store.Snapshot(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong snapshot of empty store, exp %v, got %v", exp, got)
+	}
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	if err := store.LoadInvertedPerms(strings.NewReader(`{"status": ["*"]}`)); err != nil {
+		t.Fatalf("failed to load inverted perms: %s", err.Error())
+	}
+
+	snap := store.Snapshot()
+	exp := map[string][]string{
+		"alice":  {"query", "status"},
+		"bob":    {"execute", "status"},
+		AllUsers: {"status"},
+	}
+	if !reflect.DeepEqual(exp, snap) {
+		t.Fatalf("wrong snapshot, exp %v, got %v", exp, snap)
+	}
+
+	// The snapshot is unaffected by later changes, and vice versa.
+	snap["alice"][0] = "all"
+	if err := store.AddUser(Credential{Username: "carol", Password: "password3"}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	store.RemoveUser("bob")
+	if _, ok := snap["bob"]; !ok {
+		t.Fatalf("snapshot changed by later removal")
+	}
+	if _, ok := snap["carol"]; ok {
+		t.Fatalf("snapshot changed by later addition")
+	}
+	if store.HasPerm("alice", PermAll) {
+		t.Fatalf("store changed by modifying snapshot")
+	}
+}
+
+func Test_AuthLoadCommaSeparatedPerms(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username1", "password": "password1", "perms": "query, status ,ready"},
+			{"username": "username2", "password": "password2", "perms": ["execute"]},
+			{"username": "username3", "password": "password3", "perms": ""},
+			{"username": "username4", "password": "password4", "perms": null}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not loaded correctly")
+	}
+	for _, tt := range []struct {
+		username string
+		exp      []string
+	}{
+		{"username1", []string{"query", "ready", "status"}},
+		{"username2", []string{"execute"}},
+		{"username3", nil},
+		{"username4", nil},
+	} {
+		if got := store.Perms(tt.username); !reflect.DeepEqual(tt.exp, got) {
+			t.Fatalf("wrong perms for %s, exp %v, got %v", tt.username, tt.exp, got)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := store.Dump(&buf); err != nil {
+		t.Fatalf("failed to dump: %s", err.Error())
+	}
+	if !strings.Contains(buf.String(), `"perms":["query","ready","status"]`) {
+		t.Fatalf("perms not dumped as array: %s", buf.String())
+	}
+
+	if err := store.Load(strings.NewReader(`[{"username": "username5", "perms": 5}]`)); err == nil {
+		t.Fatalf("expected error for perms of wrong type")
+	}
+}
+
+func Test_AuthLean(t *testing.T) {
+	store := NewCredentialsStore()
+	store.Lean = true
+	if err := store.AddUser(Credential{Username: "username1", Password: mustBcrypt(t, "password1"), Perms: []string{PermQuery}}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	var events []AuditEvent
+	store.SetAuditHook(func(e AuditEvent) {
+		events = append(events, e)
+	})
+
+	if !store.AA("username1", "password1", PermQuery) {
+		t.Fatalf("username1 denied query")
+	}
+	if store.AA("username1", "wrong", PermQuery) {
+		t.Fatalf("username1 allowed query with wrong password")
+	}
+	if _, ok := store.LastLogin("username1"); ok {
+		t.Fatalf("last login recorded for request while lean")
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated")
+	}
+	if _, ok := store.LastLogin("username1"); !ok {
+		t.Fatalf("explicit login not recorded while lean")
+	}
+	if len(events) != 0 {
+		t.Fatalf("audit hook called while lean, got %+v", events)
+	}
+	if got := store.Stats(); got != (Stats{}) {
+		t.Fatalf("stats counted while lean, got %+v", got)
+	}
+
+	store.Lean = false
+	store.AA("username1", "password1", PermQuery)
+	if len(events) != 1 {
+		t.Fatalf("audit hook not called once lean was cleared, got %+v", events)
+	}
+	if got := store.Stats(); got.Checks != 1 || got.CacheHits != 1 {
+		t.Fatalf("stats not counted once lean was cleared, got %+v", got)
+	}
+}
+
 func mustWriteTempFile(t *testing.T, s string) string {
 	f, err := os.CreateTemp(t.TempDir(), "rqlite-test")
 	if err != nil {
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CSVOptions configures how LoadCSVWithOptions parses CSV input.
+type CSVOptions struct {
+	// Comma is the field delimiter. If zero, ',' is used.
+	Comma rune
+
+	// Header indicates the first row names the columns. The columns must then
+	// include "username", "password", and "perms", in any order. If false,
+	// every row is a credential with columns in that order.
+	Header bool
+}
+
+// DefaultCSVOptions are the options used by LoadCSV.
+var DefaultCSVOptions = CSVOptions{
+	Comma:  ',',
+	Header: true,
+}
+
+// LoadCSV loads credential information from a reader containing CSV, using
+// DefaultCSVOptions.
+func (c *CredentialsStore) LoadCSV(r io.Reader) error {
+	return c.LoadCSVWithOptions(r, DefaultCSVOptions)
+}
+
+// LoadCSVWithOptions loads credential information from a reader containing
+// RFC 4180 CSV with username, password, and perms columns. The perms column is
+// a semicolon-separated list of perms. If any row is malformed an error naming
+// the row is returned, and the store is left unchanged. The credentials are
+// then checked and added as by Load, so the same problems are rejected.
+func (c *CredentialsStore) LoadCSVWithOptions(r io.Reader, opts CSVOptions) error {
+	cr := csv.NewReader(r)
+	if opts.Comma != 0 {
+		cr.Comma = opts.Comma
+	}
+
+	cols := map[string]int{"username": 0, "password": 1, "perms": 2}
+	row := 0
+	if opts.Header {
+		hdr, err := cr.Read()
+		if err != nil {
+			return fmt.Errorf("row 1: %w", err)
+		}
+		row++
+		cols = make(map[string]int, len(hdr))
+		for i, h := range hdr {
+			cols[strings.ToLower(strings.TrimSpace(h))] = i
+		}
+		for _, h := range []string{"username", "password", "perms"} {
+			if _, ok := cols[h]; !ok {
+				return fmt.Errorf("row 1: missing %q column", h)
+			}
+		}
+	}
+
+	var creds []Credential
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		row++
+		if err != nil {
+			return fmt.Errorf("row %d: %w", row, err)
+		}
+		if len(rec) < 3 {
+			return fmt.Errorf("row %d: expected 3 fields, got %d", row, len(rec))
+		}
+
+		cred := Credential{
+			Username: rec[cols["username"]],
+			Password: rec[cols["password"]],
+		}
+		if cred.Username == "" {
+			return fmt.Errorf("row %d: empty username", row)
+		}
+		for _, p := range strings.Split(rec[cols["perms"]], ";") {
+			if p = strings.TrimSpace(p); p != "" {
+				cred.Perms = append(cred.Perms, p)
+			}
+		}
+		creds = append(creds, cred)
+	}
+	return c.load(creds)
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_CSVLoad(t *testing.T) {
+	const csvStream = `username,password,perms
+username1,password1,query;execute
+"user,name2","pass""word2",status
+username3,password3,
+`
+
+	store := NewCredentialsStore()
+	if err := store.LoadCSV(strings.NewReader(csvStream)); err != nil {
+		t.Fatalf("failed to load CSV: %s", err.Error())
+	}
+
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 credential not loaded correctly")
+	}
+	if !store.HasPerm("username1", PermQuery) || !store.HasPerm("username1", PermExecute) {
+		t.Fatalf("username1 perms not loaded correctly")
+	}
+	if !store.Check("user,name2", `pass"word2`) {
+		t.Fatalf("quoted credential not loaded correctly")
+	}
+	if !store.HasPerm("user,name2", PermStatus) {
+		t.Fatalf("quoted credential perms not loaded correctly")
+	}
+	if !store.Check("username3", "password3") {
+		t.Fatalf("username3 credential not loaded correctly")
+	}
+	if store.HasPerm("username3", "") {
+		t.Fatalf("username3 has empty perm")
+	}
+}
+
+func Test_CSVLoadOptions(t *testing.T) {
+	const csvStream = `perms|username|password
+query;status|username1|password1
+`
+
+	store := NewCredentialsStore()
+	if err := store.LoadCSVWithOptions(strings.NewReader(csvStream), CSVOptions{Comma: '|', Header: true}); err != nil {
+		t.Fatalf("failed to load CSV: %s", err.Error())
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 credential not loaded correctly")
+	}
+	if !store.HasPerm("username1", PermStatus) {
+		t.Fatalf("username1 perms not loaded correctly")
+	}
+
+	store = NewCredentialsStore()
+	if err := store.LoadCSVWithOptions(strings.NewReader("username2\tpassword2\tquery\n"), CSVOptions{Comma: '\t'}); err != nil {
+		t.Fatalf("failed to load headerless CSV: %s", err.Error())
+	}
+	if !store.Check("username2", "password2") || !store.HasPerm("username2", PermQuery) {
+		t.Fatalf("username2 credential not loaded correctly")
+	}
+}
+
+func Test_CSVLoadMalformed(t *testing.T) {
+	for _, tt := range []struct {
+		csv string
+		err string
+	}{
+		{
+			csv: "username,password,perms\nusername1,password1,query\nusername2,password2\n",
+			err: "row 3",
+		},
+		{
+			csv: "username,password,perms\nusername1,\"password1,query\n",
+			err: "row 2",
+		},
+		{
+			csv: "username,password,perms\n,password1,query\n",
+			err: "row 2: empty username",
+		},
+		{
+			csv: "username,perms\nusername1,query\n",
+			err: `row 1: missing "password" column`,
+		},
+	} {
+		store := NewCredentialsStore()
+		err := store.LoadCSV(strings.NewReader(tt.csv))
+		if err == nil {
+			t.Fatalf("expected error loading %q", tt.csv)
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("expected error containing %q, got %q", tt.err, err.Error())
+		}
+		if _, ok := store.Password("username1"); ok {
+			t.Fatalf("store modified by malformed CSV %q", tt.csv)
+		}
+	}
+}
+
+func Test_CSVLoadRejected(t *testing.T) {
+	hash := mustBcrypt(t, "password1")
+	costly := hash[:4] + "31" + hash[6:]
+	for _, tt := range []struct {
+		csv string
+		err string
+	}{
+		{
+			csv: "username,password,perms\nev:il,password1,query\n",
+			err: "contains a colon",
+		},
+		{
+			csv: "username,password,perms\nusername1,password1,nosuchperm\n",
+			err: `unknown perm "nosuchperm"`,
+		},
+		{
+			csv: "username,password,perms\nusername1," + costly + ",query\n",
+			err: "exceeding maximum of 15",
+		},
+		{
+			csv: "username,password,perms\nusername1,password1,query\nusername1,password2,query\n",
+			err: `duplicate username "username1"`,
+		},
+		{
+			csv: "username,password,perms\nusername1,,query\n",
+			err: `empty password for user "username1"`,
+		},
+	} {
+		store := NewCredentialsStore()
+		store.StrictPerms = true
+		store.ValidateOnLoad = true
+		err := store.LoadCSV(strings.NewReader(tt.csv))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("wrong error loading %q, exp %q, got %v", tt.csv, tt.err, err)
+		}
+		if len(store.Users()) != 0 {
+			t.Fatalf("store modified by rejected CSV %q", tt.csv)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package auth
+
+// SetEagerPerms sets whether the perms each user holds via AllUsers are merged
+// into a set of the user's own, as the store is changed, rather than looked up
+// separately by every call to HasPerm. This makes HasPerm faster at the cost of
+// memory, and of slower changes to the perms of AllUsers. It is disabled by
+// default. The perms reported by Dump and the like are unaffected.
+func (c *CredentialsStore) SetEagerPerms(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !enabled {
+		c.effective = nil
+		return
+	}
+	c.rebuildEffective()
+}
+
+// rebuildEffective recomputes the merged perms of every user. The caller must
+// hold the write lock.
+func (c *CredentialsStore) rebuildEffective() {
+	c.effective = make(map[string]PermSet, len(c.perms))
+	for u := range c.perms {
+		if u != AllUsers {
+			c.updateEffective(u)
+		}
+	}
+}
+
+// updateEffective recomputes the merged perms of username, after its perms have
+// changed, or of every user if username is AllUsers. It does nothing unless
+// eager perms are enabled. The caller must hold the write lock.
+func (c *CredentialsStore) updateEffective(username string) {
+	if c.effective == nil {
+		return
+	}
+	if username == AllUsers {
+		c.rebuildEffective()
+		return
+	}
+	perms, ok := c.perms[username]
+	if !ok {
+		delete(c.effective, username)
+		return
+	}
+	c.effective[username] = perms.Union(c.perms[AllUsers])
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_AuthEagerPerms(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"perms": ["foo", "query:*"]
+			},
+			{
+				"username": "username2",
+				"password": "password2",
+				"perms": ["bar"],
+				"deny": ["qux"]
+			},
+			{
+				"username": "*",
+				"perms": ["qux"]
+			}
+		]
+	`
+
+	store := NewCredentialsStore()
+	store.SetEagerPerms(true)
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	check := func(username, perm string, exp bool) {
+		t.Helper()
+		if got := store.HasPerm(username, perm); got != exp {
+			t.Fatalf("wrong result for %s/%s, exp %v, got %v", username, perm, exp, got)
+		}
+	}
+	check("username1", "foo", true)
+	check("username1", "query:read", true)
+	check("username1", "qux", true)
+	check("username1", "bar", false)
+	check("username2", "qux", false)
+	check("username3", "qux", true)
+	check("username3", "foo", false)
+
+	// Changes to a user, and to AllUsers, must be reflected.
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1", Perms: []string{"bar"}}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	check("username1", "foo", false)
+	check("username1", "bar", true)
+	if err := store.AddUser(Credential{Username: AllUsers, Perms: []string{"baz"}}); err != nil {
+		t.Fatalf("failed to add AllUsers: %s", err.Error())
+	}
+	check("username1", "baz", true)
+	check("username1", "qux", false)
+	if err := store.LoadInvertedPerms(strings.NewReader(`{"quux": ["username1"]}`)); err != nil {
+		t.Fatalf("failed to load inverted perms: %s", err.Error())
+	}
+	check("username1", "quux", true)
+	if !store.RemoveUser("username1") {
+		t.Fatalf("username1 not removed")
+	}
+	check("username1", "bar", false)
+	check("username1", "baz", true)
+
+	other := NewCredentialsStore()
+	if err := other.Load(strings.NewReader(`[{"username": "*", "perms": ["corge"]}]`)); err != nil {
+		t.Fatalf("failed to load other credentials: %s", err.Error())
+	}
+	if err := store.Merge(other); err != nil {
+		t.Fatalf("failed to merge: %s", err.Error())
+	}
+	check("username2", "corge", true)
+
+	if err := store.Reload(strings.NewReader(`[{"username": "username4", "password": "password4", "perms": ["foo"]}]`)); err != nil {
+		t.Fatalf("failed to reload credentials: %s", err.Error())
+	}
+	check("username2", "bar", false)
+	check("username4", "foo", true)
+	check("username4", "corge", false)
+
+	store.SetEagerPerms(false)
+	check("username4", "foo", true)
+	check("username4", "corge", false)
+}
+
+func Test_AuthEagerPermsEnabledAfterLoad(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(`[{"username": "username1", "perms": ["foo"]}, {"username": "*", "perms": ["bar"]}]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	store.SetEagerPerms(true)
+	if !store.HasPerm("username1", "foo") || !store.HasPerm("username1", "bar") {
+		t.Fatalf("username1 missing perms after enabling eager perms")
+	}
+	if store.HasPerm("username1", "baz") {
+		t.Fatalf("username1 has perm not granted")
+	}
+}
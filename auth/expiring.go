@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"sort"
+	"time"
+)
+
+// ExpiringSoon returns the sorted usernames whose credentials expire within the
+// given period from now, for example to remind their owners to rotate them.
+// Credentials which have already expired, or which never expire, are not
+// included.
+func (c *CredentialsStore) ExpiringSoon(within time.Duration) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now()
+	deadline := now.Add(within)
+	var usernames []string
+	for u, t := range c.expires {
+		if t.After(now) && !t.After(deadline) {
+			usernames = append(usernames, u)
+		}
+	}
+	sort.Strings(usernames)
+	return usernames
+}
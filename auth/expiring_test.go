@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_AuthExpiringSoon(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username1", "password": "password1", "expires": "2024-01-01T12:00:00Z"},
+			{"username": "username2", "password": "password2", "expires": "2024-01-08T00:00:00Z"},
+			{"username": "username3", "password": "password3", "expires": "2024-02-01T00:00:00Z"},
+			{"username": "username4", "password": "password4", "expires": "2023-12-31T00:00:00Z"},
+			{"username": "username5", "password": "password5"}
+		]
+	`
+
+	store := NewCredentialsStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	if exp, got := []string{"username1", "username2"}, store.ExpiringSoon(7*24*time.Hour); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong users expiring within a week, exp %v, got %v", exp, got)
+	}
+	if exp, got := []string{"username1"}, store.ExpiringSoon(time.Hour*12); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong users expiring within 12 hours, exp %v, got %v", exp, got)
+	}
+	if got := store.ExpiringSoon(time.Hour); got != nil {
+		t.Fatalf("expected no users expiring within an hour, got %v", got)
+	}
+
+	now = now.Add(24 * time.Hour)
+	if exp, got := []string{"username2"}, store.ExpiringSoon(7*24*time.Hour); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong users expiring within a week of a day later, exp %v, got %v", exp, got)
+	}
+}
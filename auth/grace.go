@@ -0,0 +1,31 @@
+package auth
+
+import "time"
+
+// SetPermGracePeriod makes perm a perm whose requirement is being introduced
+// gradually. Until the given time, AA allows an authenticated user who lacks
+// perm as if it were granted, but reports the decision to the audit hook with
+// AuditReasonGracePeriod, so would-be denials can be found and fixed before
+// perm is enforced. Perms explicitly denied to a user are never allowed. The
+// zero time removes the grace period of perm.
+func (c *CredentialsStore) SetPermGracePeriod(perm string, until time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if until.IsZero() {
+		delete(c.gracePeriods, perm)
+		return
+	}
+	if c.gracePeriods == nil {
+		c.gracePeriods = make(map[string]time.Time)
+	}
+	c.gracePeriods[perm] = until
+}
+
+// inGracePeriod returns true if perm is in its grace period, and is not
+// explicitly denied to username.
+func (c *CredentialsStore) inGracePeriod(username, perm string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	until, ok := c.gracePeriods[perm]
+	return ok && c.now().Before(until) && !c.isDenied(username, perm)
+}
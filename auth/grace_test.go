@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_AuthPermGracePeriod(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username1", "password": "password1", "perms": ["query"]},
+			{"username": "username2", "password": "password2", "deny": ["execute"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	var events []AuditEvent
+	store.SetAuditHook(func(e AuditEvent) {
+		events = append(events, e)
+	})
+	store.SetPermGracePeriod(PermExecute, now.Add(time.Hour))
+
+	// In grace, a missing perm is allowed but reported.
+	if !store.AA("username1", "password1", PermExecute) {
+		t.Fatalf("username1 not allowed execute during grace period")
+	}
+	if exp := (AuditEvent{now, "username1", PermExecute, true, AuditReasonGracePeriod}); len(events) != 1 || events[0] != exp {
+		t.Fatalf("wrong audit events during grace period, exp %+v, got %+v", exp, events)
+	}
+	if store.AA("username1", "wrong", PermExecute) {
+		t.Fatalf("username1 allowed execute during grace period with wrong password")
+	}
+	if store.AA("", "", PermExecute) {
+		t.Fatalf("anonymous request allowed execute during grace period")
+	}
+	if store.AA("username2", "password2", PermExecute) {
+		t.Fatalf("username2 allowed denied perm during grace period")
+	}
+	if store.AA("username1", "password1", PermRemove) {
+		t.Fatalf("username1 allowed perm with no grace period")
+	}
+
+	// After grace, the perm is enforced.
+	now = now.Add(time.Hour)
+	if store.AA("username1", "password1", PermExecute) {
+		t.Fatalf("username1 allowed execute after grace period")
+	}
+	if got := events[len(events)-1]; got.Allowed || got.Reason != AuditReasonNotGranted {
+		t.Fatalf("wrong audit event after grace period, got %+v", got)
+	}
+
+	// Removing the grace period enforces the perm at once.
+	now = now.Add(-time.Minute)
+	store.SetPermGracePeriod(PermExecute, time.Time{})
+	if store.AA("username1", "password1", PermExecute) {
+		t.Fatalf("username1 allowed execute after grace period removed")
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// GroupPrefix begins the username under which the perms of a group are stored.
+// For example, perms granted to the user "group:admins" are held by every
+// member of the group "admins", once a GroupResolver is set.
+const GroupPrefix = "group:"
+
+// groupCacheSize is the maximum number of users whose groups are cached.
+const groupCacheSize = 1024
+
+// GroupResolver returns the names of the groups username belongs to, for
+// example by querying an external directory.
+type GroupResolver func(username string) []string
+
+// groupCache caches the groups returned by a GroupResolver.
+type groupCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]groupCacheEntry
+}
+
+type groupCacheEntry struct {
+	groups   []string
+	storedAt time.Time
+}
+
+// SetGroupResolver sets a resolver which HasPerm consults if username is not
+// granted a perm directly or via AllUsers, such that username also has any perm
+// granted to GroupPrefix followed by the name of one of its groups. Perms
+// denied to username are still never held. The groups of each user are cached
+// for ttl, or resolved on every lookup if ttl is not positive, and the groups
+// of at most a fixed number of users are cached at once. While a
+// resolver is set, group entries cannot authenticate as users. Passing nil
+// removes the resolver, which is the default.
+func (c *CredentialsStore) SetGroupResolver(resolver GroupResolver, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.groupResolver = resolver
+	c.groups = &groupCache{
+		ttl:     ttl,
+		entries: make(map[string]groupCacheEntry),
+	}
+}
+
+// resolveGroups returns the groups of username, as returned by resolver or
+// cached from an earlier call. AllUsers, AuthedUsers and anonymous users are
+// not real users, so belong to no groups, and the resolver is not called for
+// them.
+func (c *CredentialsStore) resolveGroups(resolver GroupResolver, gc *groupCache, username string) []string {
+	if username == AllUsers || username == AuthedUsers || IsAnonymous(username) {
+		return nil
+	}
+	if gc.ttl <= 0 {
+		return resolver(username)
+	}
+	gc.mu.Lock()
+	e, ok := gc.entries[username]
+	gc.mu.Unlock()
+	if ok && c.now().Sub(e.storedAt) < gc.ttl {
+		return e.groups
+	}
+
+	groups := resolver(username)
+	now := c.now()
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	if _, ok := gc.entries[username]; !ok && len(gc.entries) >= groupCacheSize {
+		gc.evict(now)
+	}
+	gc.entries[username] = groupCacheEntry{groups: groups, storedAt: now}
+	return groups
+}
+
+// evict removes every expired entry from the cache or, if none has expired,
+// the oldest entry, so that usernames supplied by clients cannot grow the cache
+// without bound. The caller must hold the lock.
+func (gc *groupCache) evict(now time.Time) {
+	var oldest string
+	var oldestAt time.Time
+	for u, e := range gc.entries {
+		if now.Sub(e.storedAt) >= gc.ttl {
+			delete(gc.entries, u)
+		} else if oldestAt.IsZero() || e.storedAt.Before(oldestAt) {
+			oldest, oldestAt = u, e.storedAt
+		}
+	}
+	if len(gc.entries) >= groupCacheSize {
+		delete(gc.entries, oldest)
+	}
+}
+
+// isGroup returns true if username is the entry of a group, and a group
+// resolver is set. The caller must hold the read lock.
+func (c *CredentialsStore) isGroup(username string) bool {
+	return c.groupResolver != nil && strings.HasPrefix(username, GroupPrefix)
+}
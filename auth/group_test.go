@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_AuthGroupResolver(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"perms": ["status"]
+			},
+			{
+				"username": "username2",
+				"password": "password2",
+				"deny": ["remove"]
+			},
+			{
+				"username": "group:admins",
+				"perms": ["remove", "execute"]
+			}
+		]
+	`
+
+	store := NewCredentialsStore()
+	store.AllowEmptyPassword = true
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	if store.HasPerm("username1", "remove") {
+		t.Fatalf("username1 has group perm with no resolver")
+	}
+
+	calls := 0
+	store.SetGroupResolver(func(username string) []string {
+		calls++
+		if username == "username1" || username == "username2" {
+			return []string{"admins"}
+		}
+		return nil
+	}, 0)
+	if !store.HasPerm("username1", "remove") {
+		t.Fatalf("username1 does not have perm via group")
+	}
+	if !store.HasPerm("username1", "status") {
+		t.Fatalf("username1 does not have direct perm")
+	}
+	if !store.AA("username1", "password1", "execute") {
+		t.Fatalf("username1 not authorized via group")
+	}
+	if store.HasPerm("username2", "remove") {
+		t.Fatalf("username2 has denied perm via group")
+	}
+	if store.HasPerm("username3", "remove") {
+		t.Fatalf("username3 has perm of group it is not in")
+	}
+	if store.AA("group:admins", "", "remove") {
+		t.Fatalf("group authenticated as a user")
+	}
+	if calls == 0 {
+		t.Fatalf("resolver not called")
+	}
+
+	store.SetGroupResolver(nil, 0)
+	if store.HasPerm("username1", "remove") {
+		t.Fatalf("username1 has group perm after resolver removed")
+	}
+}
+
+func Test_AuthGroupResolverCache(t *testing.T) {
+	store := NewCredentialsStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	if err := store.Load(strings.NewReader(`[{"username": "group:admins", "perms": ["remove"]}]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	calls := 0
+	groups := []string{"admins"}
+	store.SetGroupResolver(func(username string) []string {
+		calls++
+		return groups
+	}, time.Minute)
+	for i := 0; i < 3; i++ {
+		if !store.HasPerm("username1", "remove") {
+			t.Fatalf("username1 does not have perm via group")
+		}
+	}
+	if exp, got := 1, calls; exp != got {
+		t.Fatalf("wrong number of resolver calls, exp %d, got %d", exp, got)
+	}
+
+	// Membership changes are seen once the cached groups expire.
+	groups = nil
+	if !store.HasPerm("username1", "remove") {
+		t.Fatalf("cached groups not used")
+	}
+	now = now.Add(time.Minute)
+	if store.HasPerm("username1", "remove") {
+		t.Fatalf("expired groups still used")
+	}
+	if exp, got := 2, calls; exp != got {
+		t.Fatalf("wrong number of resolver calls, exp %d, got %d", exp, got)
+	}
+}
+
+func Test_AuthGroupResolverCacheBounded(t *testing.T) {
+	store := NewCredentialsStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	var resolved []string
+	store.SetGroupResolver(func(username string) []string {
+		resolved = append(resolved, username)
+		return nil
+	}, time.Minute)
+
+	// Neither pseudo-users nor anonymous users are resolved.
+	store.HasPerm(AllUsers, "remove")
+	store.HasPerm(AuthedUsers, "remove")
+	store.HasPerm("", "remove")
+	store.AA("", "", "remove")
+	if len(resolved) != 0 {
+		t.Fatalf("resolver called for %v", resolved)
+	}
+
+	for i := 0; i < 2*groupCacheSize; i++ {
+		store.HasPerm(fmt.Sprintf("username%d", i), "remove")
+		now = now.Add(time.Millisecond)
+	}
+	if got := len(store.groups.entries); got > groupCacheSize {
+		t.Fatalf("group cache grew to %d entries, exceeding %d", got, groupCacheSize)
+	}
+
+	// The most recent entries are kept, and expired ones all pruned at once.
+	n := len(resolved)
+	store.HasPerm(fmt.Sprintf("username%d", 2*groupCacheSize-1), "remove")
+	if len(resolved) != n {
+		t.Fatalf("most recently cached groups evicted")
+	}
+	now = now.Add(time.Minute)
+	store.HasPerm("username", "remove")
+	if exp, got := 1, len(store.groups.entries); exp != got {
+		t.Fatalf("expired entries not pruned, exp %d entries, got %d", exp, got)
+	}
+}
@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// DefaultHashCacheSize is the maximum number of entries held by a HashCache
+// created by NewHashCache.
+const DefaultHashCacheSize = 1024
+
+// DefaultHashCacheShards is the number of shards of a HashCache created by
+// NewShardedHashCache with a shard count which is not positive.
+const DefaultHashCacheShards = 16
+
+// HashCache stores password hashes which have been verified for users, so that
+// expensive hash computations need not be repeated. It holds a bounded number
+// of entries, evicting the least-recently checked entry when full, and entries
+// may optionally expire a fixed time after they are stored. Safe for use from
+// multiple goroutines. A cache created by NewShardedHashCache is split into
+// shards, each with a lock of its own, and evicts per shard.
+type HashCache struct {
+	ttl    time.Duration
+	now    func() time.Time
+	shards []*hashCacheShard
+}
+
+// hashCacheShard is a least-recently-used cache of the entries for the
+// usernames which hash to it.
+type hashCacheShard struct {
+	mu   sync.Mutex
+	size int
+	ll   *list.List // Front is most recently used.
+	m    map[string]map[string]*list.Element
+}
+
+type hashCacheEntry struct {
+	username string
+	hash     string
+	storedAt time.Time
+}
+
+// HashCachePolicyLRU is the eviction policy of every HashCache, which evicts
+// the least-recently used entry when full.
+const HashCachePolicyLRU = "lru"
+
+// HashCacheConfig describes the configuration of a HashCache, and how many
+// entries it holds, as returned by Config.
+type HashCacheConfig struct {
+	// Capacity is the maximum number of entries the cache holds.
+	Capacity int
+
+	// TTL is how long an entry remains valid after it is stored, or zero if
+	// entries never expire.
+	TTL time.Duration
+
+	// Policy is the eviction policy, HashCachePolicyLRU.
+	Policy string
+
+	// Shards is the number of shards the cache is split into.
+	Shards int
+
+	// Len is the number of entries in the cache.
+	Len int
+}
+
+// HashCacheOption configures a HashCache.
+type HashCacheOption func(*HashCache)
+
+// WithTTL sets how long an entry remains valid after it is stored. After that
+// Check treats it as absent, forcing the hash to be verified again. A TTL of
+// zero, the default, means entries never expire.
+func WithTTL(ttl time.Duration) HashCacheOption {
+	return func(h *HashCache) {
+		h.ttl = ttl
+	}
+}
+
+// WithClock sets the function the cache uses to tell the time, in place of
+// time.Now.
+func WithClock(now func() time.Time) HashCacheOption {
+	return func(h *HashCache) {
+		h.now = now
+	}
+}
+
+// NewHashCache returns a instantiated HashCache, holding at most
+// DefaultHashCacheSize entries.
+func NewHashCache(opts ...HashCacheOption) *HashCache {
+	return NewHashCacheWithSize(DefaultHashCacheSize, opts...)
+}
+
+// NewHashCacheWithSize returns a instantiated HashCache, holding at most n
+// entries. If n is not positive, DefaultHashCacheSize is used.
+func NewHashCacheWithSize(n int, opts ...HashCacheOption) *HashCache {
+	if n <= 0 {
+		n = DefaultHashCacheSize
+	}
+	return newHashCache(n, 1, opts)
+}
+
+// NewShardedHashCache returns a instantiated HashCache split into the given
+// number of shards, so that checks for users in different shards do not
+// contend for a lock. If shards is not positive, DefaultHashCacheShards is
+// used. The DefaultHashCacheSize entries it holds are divided evenly among the
+// shards, and the least-recently used entry of a full shard is evicted, even
+// if other shards hold entries used less recently.
+func NewShardedHashCache(shards int, opts ...HashCacheOption) *HashCache {
+	if shards <= 0 {
+		shards = DefaultHashCacheShards
+	}
+	return newHashCache((DefaultHashCacheSize+shards-1)/shards, shards, opts)
+}
+
+// newHashCache returns a HashCache of the given number of shards, each holding
+// at most size entries.
+func newHashCache(size, shards int, opts []HashCacheOption) *HashCache {
+	h := &HashCache{
+		now:    time.Now,
+		shards: make([]*hashCacheShard, shards),
+	}
+	for i := range h.shards {
+		h.shards[i] = &hashCacheShard{
+			size: size,
+			ll:   list.New(),
+			m:    make(map[string]map[string]*list.Element),
+		}
+	}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
+}
+
+// shard returns the shard holding the entries for username.
+func (h *HashCache) shard(username string) *hashCacheShard {
+	if len(h.shards) == 1 {
+		return h.shards[0]
+	}
+	// FNV-1a, computed inline to avoid allocating a hash.Hash32.
+	sum := uint32(2166136261)
+	for i := 0; i < len(username); i++ {
+		sum ^= uint32(username[i])
+		sum *= 16777619
+	}
+	return h.shards[sum%uint32(len(h.shards))]
+}
+
+// Check returns whether hash is valid for username. A successful check counts
+// as a use of the entry. An expired entry is removed, and treated as absent.
+func (h *HashCache) Check(username, hash string) bool {
+	s := h.shard(username)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.m[username][hash]
+	if !ok {
+		return false
+	}
+	if h.ttl > 0 && h.now().Sub(e.Value.(*hashCacheEntry).storedAt) >= h.ttl {
+		s.remove(e)
+		return false
+	}
+	s.ll.MoveToFront(e)
+	return true
+}
+
+// Store stores the given hash as a valid hash for username, evicting the
+// least-recently used entry if the cache is full.
+func (h *HashCache) Store(username, hash string) {
+	s := h.shard(username)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.m[username][hash]; ok {
+		e.Value.(*hashCacheEntry).storedAt = h.now()
+		s.ll.MoveToFront(e)
+		return
+	}
+
+	if s.ll.Len() >= s.size {
+		s.remove(s.ll.Back())
+	}
+	if _, ok := s.m[username]; !ok {
+		s.m[username] = make(map[string]*list.Element)
+	}
+	s.m[username][hash] = s.ll.PushFront(&hashCacheEntry{
+		username: username,
+		hash:     hash,
+		storedAt: h.now(),
+	})
+}
+
+// Invalidate removes all hashes stored for username.
+func (h *HashCache) Invalidate(username string) {
+	s := h.shard(username)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.m[username] {
+		s.ll.Remove(e)
+	}
+	delete(s.m, username)
+}
+
+// Clear removes every entry from the cache.
+func (h *HashCache) Clear() {
+	for _, s := range h.shards {
+		s.mu.Lock()
+		s.ll.Init()
+		s.m = make(map[string]map[string]*list.Element)
+		s.mu.Unlock()
+	}
+}
+
+// Len returns the number of entries in the cache.
+func (h *HashCache) Len() int {
+	n := 0
+	for _, s := range h.shards {
+		s.mu.Lock()
+		n += s.ll.Len()
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Config returns the configuration of the cache, and the number of entries it
+// holds.
+func (h *HashCache) Config() HashCacheConfig {
+	return HashCacheConfig{
+		Capacity: h.shards[0].size * len(h.shards),
+		TTL:      h.ttl,
+		Policy:   HashCachePolicyLRU,
+		Shards:   len(h.shards),
+		Len:      h.Len(),
+	}
+}
+
+// remove removes e from the shard. The caller must hold the shard's lock.
+func (s *hashCacheShard) remove(e *list.Element) {
+	ent := s.ll.Remove(e).(*hashCacheEntry)
+	delete(s.m[ent.username], ent.hash)
+	if len(s.m[ent.username]) == 0 {
+		delete(s.m, ent.username)
+	}
+}
+
+// cacheKey returns the key under which a successful verification of given
+// against stored is cached. It covers both passwords, so a cached entry never
+// matches once the stored password changes, and plaintext passwords are never
+// held in the cache.
+func cacheKey(stored, given string) string {
+	h := sha256.New()
+	h.Write([]byte(stored))
+	h.Write([]byte{0})
+	h.Write([]byte(given))
+	return string(h.Sum(nil))
+}
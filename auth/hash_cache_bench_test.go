@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// The benchmarks below check and store hashes for many users from parallel
+// goroutines. The sharded cache should scale better with GOMAXPROCS, as
+// goroutines working on users in different shards do not contend for a lock.
+
+func BenchmarkHashCacheParallel(b *testing.B) {
+	benchmarkHashCacheParallel(b, NewHashCache())
+}
+
+func BenchmarkShardedHashCacheParallel(b *testing.B) {
+	benchmarkHashCacheParallel(b, NewShardedHashCache(0))
+}
+
+func benchmarkHashCacheParallel(b *testing.B, hc *HashCache) {
+	usernames := make([]string, 512)
+	for i := range usernames {
+		usernames[i] = fmt.Sprintf("username%d", i)
+		hc.Store(usernames[i], "hash1")
+	}
+	var next int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddInt64(&next, 1))
+		for pb.Next() {
+			username := usernames[i%len(usernames)]
+			if !hc.Check(username, "hash1") {
+				hc.Store(username, "hash1")
+			}
+			i++
+		}
+	})
+}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_HashCache(t *testing.T) {
+	hc := NewHashCache()
+	if hc.Check("username1", "hash1") {
+		t.Fatalf("empty cache returned true")
+	}
+
+	hc.Store("username1", "hash1")
+	if !hc.Check("username1", "hash1") {
+		t.Fatalf("stored hash not found")
+	}
+	if hc.Check("username1", "hash2") {
+		t.Fatalf("unstored hash found")
+	}
+	if hc.Check("username2", "hash1") {
+		t.Fatalf("hash found for wrong user")
+	}
+
+	hc.Store("username1", "hash2")
+	if !hc.Check("username1", "hash1") || !hc.Check("username1", "hash2") {
+		t.Fatalf("multiple hashes not stored for user")
+	}
+
+	hc.Store("username2", "hash1")
+	hc.Invalidate("username1")
+	if hc.Check("username1", "hash1") || hc.Check("username1", "hash2") {
+		t.Fatalf("hashes found after invalidation")
+	}
+	if !hc.Check("username2", "hash1") {
+		t.Fatalf("invalidation removed hash for other user")
+	}
+}
+
+func Test_HashCacheClear(t *testing.T) {
+	hc := NewHashCacheWithSize(2)
+	hc.Store("username1", "hash1")
+	hc.Store("username2", "hash1")
+	hc.Clear()
+	if exp, got := 0, hc.Len(); exp != got {
+		t.Fatalf("wrong cache length after clear, exp %d, got %d", exp, got)
+	}
+	if hc.Check("username1", "hash1") || hc.Check("username2", "hash1") {
+		t.Fatalf("hashes found after clear")
+	}
+
+	// The cache must remain usable, and bounded, after being cleared.
+	hc.Store("username1", "hash1")
+	hc.Store("username1", "hash2")
+	hc.Store("username1", "hash3")
+	if exp, got := 2, hc.Len(); exp != got {
+		t.Fatalf("wrong cache length, exp %d, got %d", exp, got)
+	}
+	if !hc.Check("username1", "hash3") {
+		t.Fatalf("stored hash not found after clear")
+	}
+}
+
+func Test_HashCacheLRU(t *testing.T) {
+	hc := NewHashCacheWithSize(3)
+	hc.Store("username1", "hash1")
+	hc.Store("username1", "hash2")
+	hc.Store("username2", "hash1")
+	if exp, got := 3, hc.Len(); exp != got {
+		t.Fatalf("wrong cache length, exp %d, got %d", exp, got)
+	}
+
+	// Using username1/hash1 makes username1/hash2 the least recently used.
+	if !hc.Check("username1", "hash1") {
+		t.Fatalf("stored hash not found")
+	}
+	hc.Store("username3", "hash1")
+	if exp, got := 3, hc.Len(); exp != got {
+		t.Fatalf("wrong cache length after eviction, exp %d, got %d", exp, got)
+	}
+	if hc.Check("username1", "hash2") {
+		t.Fatalf("least recently used entry not evicted")
+	}
+	for _, e := range [][2]string{{"username1", "hash1"}, {"username2", "hash1"}, {"username3", "hash1"}} {
+		if !hc.Check(e[0], e[1]) {
+			t.Fatalf("entry %v evicted", e)
+		}
+	}
+
+	// Storing an existing entry doesn't grow the cache.
+	hc.Store("username3", "hash1")
+	if exp, got := 3, hc.Len(); exp != got {
+		t.Fatalf("wrong cache length after restore, exp %d, got %d", exp, got)
+	}
+
+	hc.Invalidate("username1")
+	if exp, got := 2, hc.Len(); exp != got {
+		t.Fatalf("wrong cache length after invalidate, exp %d, got %d", exp, got)
+	}
+}
+
+func Test_HashCacheDefaultSize(t *testing.T) {
+	hc := NewHashCacheWithSize(0)
+	for i := 0; i < DefaultHashCacheSize+10; i++ {
+		hc.Store("username1", fmt.Sprintf("hash%d", i))
+	}
+	if exp, got := DefaultHashCacheSize, hc.Len(); exp != got {
+		t.Fatalf("wrong cache length, exp %d, got %d", exp, got)
+	}
+}
+
+func Test_HashCacheTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	hc := NewHashCache(WithTTL(5*time.Minute), WithClock(func() time.Time { return now }))
+
+	hc.Store("username1", "hash1")
+	now = now.Add(4 * time.Minute)
+	hc.Store("username1", "hash2")
+	if !hc.Check("username1", "hash1") || !hc.Check("username1", "hash2") {
+		t.Fatalf("unexpired hashes not found")
+	}
+
+	now = now.Add(time.Minute)
+	if hc.Check("username1", "hash1") {
+		t.Fatalf("expired hash found")
+	}
+	if exp, got := 1, hc.Len(); exp != got {
+		t.Fatalf("expired entry not removed, exp length %d, got %d", exp, got)
+	}
+	if !hc.Check("username1", "hash2") {
+		t.Fatalf("unexpired hash not found")
+	}
+
+	// Storing again refreshes the entry.
+	now = now.Add(3 * time.Minute)
+	hc.Store("username1", "hash2")
+	now = now.Add(3 * time.Minute)
+	if !hc.Check("username1", "hash2") {
+		t.Fatalf("refreshed hash not found")
+	}
+}
+
+func Test_HashCacheNoTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	hc := NewHashCache(WithClock(func() time.Time { return now }))
+	hc.Store("username1", "hash1")
+	now = now.Add(24 * 365 * time.Hour)
+	if !hc.Check("username1", "hash1") {
+		t.Fatalf("hash expired with no TTL set")
+	}
+}
+
+func Test_CacheKey(t *testing.T) {
+	if cacheKey("a", "b") != cacheKey("a", "b") {
+		t.Fatalf("cache key not deterministic")
+	}
+	if cacheKey("a", "b") == cacheKey("a", "c") || cacheKey("a", "b") == cacheKey("c", "b") {
+		t.Fatalf("cache key collision")
+	}
+	if cacheKey("ab", "c") == cacheKey("a", "bc") {
+		t.Fatalf("cache key does not separate stored and given")
+	}
+}
+
+func Test_ShardedHashCache(t *testing.T) {
+	hc := NewShardedHashCache(0)
+	if len(hc.shards) != DefaultHashCacheShards {
+		t.Fatalf("wrong number of shards, exp %d, got %d", DefaultHashCacheShards, len(hc.shards))
+	}
+
+	for i := 0; i < 100; i++ {
+		hc.Store(fmt.Sprintf("username%d", i), "hash1")
+	}
+	hc.Store("username1", "hash2")
+	if hc.Len() != 101 {
+		t.Fatalf("wrong cache length, exp 101, got %d", hc.Len())
+	}
+	for i := 0; i < 100; i++ {
+		if !hc.Check(fmt.Sprintf("username%d", i), "hash1") {
+			t.Fatalf("stored hash not found for username%d", i)
+		}
+	}
+	if hc.Check("username1", "hash3") || hc.Check("username100", "hash1") {
+		t.Fatalf("unstored hash found")
+	}
+
+	hc.Invalidate("username1")
+	if hc.Check("username1", "hash1") || hc.Check("username1", "hash2") {
+		t.Fatalf("hashes found after invalidation")
+	}
+	if !hc.Check("username2", "hash1") {
+		t.Fatalf("invalidation removed hash for other user")
+	}
+
+	hc.Clear()
+	if hc.Len() != 0 {
+		t.Fatalf("cache not empty after clear, got %d", hc.Len())
+	}
+}
+
+func Test_ShardedHashCacheSize(t *testing.T) {
+	hc := NewShardedHashCache(4)
+	for i := 0; i < 2*DefaultHashCacheSize; i++ {
+		hc.Store(fmt.Sprintf("username%d", i), "hash1")
+	}
+	if hc.Len() > DefaultHashCacheSize {
+		t.Fatalf("cache exceeds default size, got %d", hc.Len())
+	}
+	if !hc.Check(fmt.Sprintf("username%d", 2*DefaultHashCacheSize-1), "hash1") {
+		t.Fatalf("most recently stored hash evicted")
+	}
+}
+
+func Test_ShardedHashCacheTTL(t *testing.T) {
+	now := time.Now()
+	hc := NewShardedHashCache(4, WithTTL(time.Minute), WithClock(func() time.Time { return now }))
+	hc.Store("username1", "hash1")
+	now = now.Add(time.Minute)
+	if hc.Check("username1", "hash1") {
+		t.Fatalf("expired hash found")
+	}
+	if hc.Len() != 0 {
+		t.Fatalf("expired hash not removed, got %d entries", hc.Len())
+	}
+}
+
+func Test_ShardedHashCacheConcurrent(t *testing.T) {
+	hc := NewShardedHashCache(8)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				username := fmt.Sprintf("username%d-%d", g, i)
+				hc.Store(username, "hash1")
+				if !hc.Check(username, "hash1") {
+					t.Errorf("stored hash not found for %s", username)
+				}
+				hc.Invalidate(username)
+				if hc.Check(username, "hash1") {
+					t.Errorf("hash found after invalidation for %s", username)
+				}
+				hc.Store(username, "hash2")
+				hc.Len()
+			}
+		}(g)
+	}
+	wg.Wait()
+	if hc.Len() != 800 {
+		t.Fatalf("wrong cache length, exp 800, got %d", hc.Len())
+	}
+}
+
+func Test_HashCacheConfig(t *testing.T) {
+	hc := NewHashCacheWithSize(10, WithTTL(time.Minute))
+	hc.Store("username1", "hash1")
+	hc.Store("username2", "hash1")
+	exp := HashCacheConfig{Capacity: 10, TTL: time.Minute, Policy: HashCachePolicyLRU, Shards: 1, Len: 2}
+	if got := hc.Config(); got != exp {
+		t.Fatalf("wrong config, exp %+v, got %+v", exp, got)
+	}
+
+	hc = NewShardedHashCache(8)
+	exp = HashCacheConfig{Capacity: DefaultHashCacheSize, Policy: HashCachePolicyLRU, Shards: 8}
+	if got := hc.Config(); got != exp {
+		t.Fatalf("wrong sharded config, exp %+v, got %+v", exp, got)
+	}
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// HashingPool is a fixed number of goroutines which perform the hash
+// comparisons needed to verify passwords, bounding how many run at once. It is
+// created by SetHashingPool.
+type HashingPool struct {
+	size    int
+	start   sync.Once
+	jobs    chan hashJob
+	workers sync.WaitGroup
+
+	mu     sync.RWMutex // protects closed, and sending on jobs
+	closed bool
+
+	compared int64
+}
+
+// hashJob is a comparison to be performed by a HashingPool, whose result is
+// sent on result.
+type hashJob struct {
+	compare       func(stored, given string) error
+	stored, given string
+	result        chan<- error
+}
+
+// SetHashingPool causes the hash comparisons performed by Check, AA and their
+// variants to be run by a pool of size goroutines, so no more than size run at
+// once however many requests arrive, replacing any pool already set. Callers
+// wait for a free goroutine, or until their context is done. The goroutines
+// are started when the first comparison is needed, so a pool costs nothing
+// until used. If size is not positive, any pool is removed, comparisons are
+// performed by their callers, which is the default, and nil is returned. The
+// returned HashingPool should be closed once no longer used, including once
+// replaced, to stop its goroutines.
+func (c *CredentialsStore) SetHashingPool(size int) *HashingPool {
+	var p *HashingPool
+	if size > 0 {
+		p = &HashingPool{
+			size: size,
+			jobs: make(chan hashJob),
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hashingPool = p
+	return p
+}
+
+// Close stops the pool's goroutines, once any comparisons under way are done.
+// Comparisons requested after Close are performed by their callers.
+func (p *HashingPool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+	p.workers.Wait()
+}
+
+// compare is like compareContext, but performs the comparison on one of the
+// pool's goroutines, starting them if need be.
+func (p *HashingPool) compare(ctx context.Context, compare func(stored, given string) error, stored, given string) error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return compareContext(ctx, compare, stored, given)
+	}
+	p.start.Do(p.run)
+	result := make(chan error, 1)
+	select {
+	case p.jobs <- hashJob{compare: compare, stored: stored, given: given, result: result}:
+		p.mu.RUnlock()
+	case <-ctx.Done():
+		p.mu.RUnlock()
+		return ctx.Err()
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run starts the pool's goroutines.
+func (p *HashingPool) run() {
+	p.workers.Add(p.size)
+	for i := 0; i < p.size; i++ {
+		go func() {
+			defer p.workers.Done()
+			for job := range p.jobs {
+				atomic.AddInt64(&p.compared, 1)
+				job.result <- job.compare(job.stored, job.given)
+			}
+		}()
+	}
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_HashingPool(t *testing.T) {
+	store := NewCredentialsStore()
+	store.UseCache = false
+	if err := store.AddUser(Credential{Username: "username1", Password: mustBcrypt(t, "password1")}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	pool := store.SetHashingPool(2)
+	if pool == nil {
+		t.Fatalf("no pool returned")
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated")
+	}
+	if store.Check("username1", "wrong") {
+		t.Fatalf("username1 authenticated with wrong password")
+	}
+	if got := atomic.LoadInt64(&pool.compared); got != 2 {
+		t.Fatalf("wrong number of comparisons on pool, exp 2, got %d", got)
+	}
+
+	// Once closed, comparisons are performed by their callers.
+	pool.Close()
+	pool.Close()
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated after pool closed")
+	}
+	if got := atomic.LoadInt64(&pool.compared); got != 2 {
+		t.Fatalf("comparison on closed pool, got %d", got)
+	}
+
+	if store.SetHashingPool(0) != nil {
+		t.Fatalf("pool returned for zero size")
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated without pool")
+	}
+}
+
+func Test_HashingPoolBounded(t *testing.T) {
+	store := NewCredentialsStore()
+	pool := store.SetHashingPool(2)
+	defer pool.Close()
+
+	var running, maxRunning int64
+	release := make(chan struct{})
+	compare := func(stored, given string) error {
+		n := atomic.AddInt64(&running, 1)
+		for {
+			m := atomic.LoadInt64(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt64(&maxRunning, m, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt64(&running, -1)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := pool.compare(context.Background(), compare, "stored", "given"); err != nil {
+				t.Errorf("comparison failed: %s", err.Error())
+			}
+		}()
+	}
+
+	// A caller waiting for a free goroutine gives up when its context is done.
+	for atomic.LoadInt64(&running) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := pool.compare(ctx, compare, "stored", "given"); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded waiting for pool, got %v", err)
+	}
+
+	close(release)
+	wg.Wait()
+	if got := atomic.LoadInt64(&maxRunning); got != 2 {
+		t.Fatalf("wrong number of concurrent comparisons, exp 2, got %d", got)
+	}
+}
+
+func Test_HashingPoolConcurrent(t *testing.T) {
+	store := NewCredentialsStore()
+	store.UseCache = false
+	if err := store.AddUser(Credential{Username: "username1", Password: mustBcrypt(t, "password1")}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	pool := store.SetHashingPool(4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if (i+j)%2 == 0 && !store.Check("username1", "password1") {
+					t.Errorf("username1 not authenticated")
+				} else if (i+j)%2 == 1 && store.Check("username1", "wrong") {
+					t.Errorf("username1 authenticated with wrong password")
+				}
+			}
+		}(i)
+	}
+
+	// Replacing and closing pools while checks are under way is safe.
+	time.Sleep(5 * time.Millisecond)
+	old := pool
+	pool = store.SetHashingPool(2)
+	old.Close()
+	wg.Wait()
+	pool.Close()
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// DefaultRealm is the realm used by Protect if the store's Realm is not set.
+const DefaultRealm = "rqlite"
+
+// Protect returns a handler which authenticates and authorizes each request for
+// perm, as by AA, using the request's basic auth credentials, before passing it
+// to next. A request whose credentials are missing or incorrect is answered
+// with 401 Unauthorized and a WWW-Authenticate header, and one from a user
+// lacking perm with 403 Forbidden. If the store is nil, auth is disabled and
+// every request is passed to next.
+func (c *CredentialsStore) Protect(perm string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		allowed, _, err := c.aa(username, password, perm, -1, checkOptions{})
+		if allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != errNotGranted {
+			c.mu.RLock()
+			realm := c.Realm
+			c.mu.RUnlock()
+			if realm == "" {
+				realm = DefaultRealm
+			}
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	})
+}
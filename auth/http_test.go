@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_AuthProtect(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"perms": ["foo"]
+			},
+			{
+				"username": "*",
+				"perms": ["status"]
+			}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, tt := range []struct {
+		name      string
+		username  string
+		password  string
+		perm      string
+		exp       int
+		challenge bool
+	}{
+		{"allowed", "username1", "password1", "foo", http.StatusTeapot, false},
+		{"all users", "", "", "status", http.StatusTeapot, false},
+		{"no credentials", "", "", "foo", http.StatusUnauthorized, true},
+		{"bad password", "username1", "wrong", "foo", http.StatusUnauthorized, true},
+		{"unknown user", "username2", "password2", "foo", http.StatusUnauthorized, true},
+		{"no perm", "username1", "password1", "bar", http.StatusForbidden, false},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.username != "" {
+			req.SetBasicAuth(tt.username, tt.password)
+		}
+		rec := httptest.NewRecorder()
+		store.Protect(tt.perm, next).ServeHTTP(rec, req)
+		if rec.Code != tt.exp {
+			t.Fatalf("%s: wrong status, exp %d, got %d", tt.name, tt.exp, rec.Code)
+		}
+		if got := rec.Header().Get("WWW-Authenticate"); (got != "") != tt.challenge {
+			t.Fatalf("%s: wrong WWW-Authenticate header, got %q", tt.name, got)
+		}
+	}
+}
+
+func Test_AuthProtectRealm(t *testing.T) {
+	store := NewCredentialsStore()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	store.Protect("foo", next).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if exp, got := `Basic realm="rqlite"`, rec.Header().Get("WWW-Authenticate"); exp != got {
+		t.Fatalf("wrong WWW-Authenticate header, exp %q, got %q", exp, got)
+	}
+
+	store.Realm = "cluster1"
+	rec = httptest.NewRecorder()
+	store.Protect("foo", next).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if exp, got := `Basic realm="cluster1"`, rec.Header().Get("WWW-Authenticate"); exp != got {
+		t.Fatalf("wrong WWW-Authenticate header, exp %q, got %q", exp, got)
+	}
+}
+
+func Test_AuthProtectNilStore(t *testing.T) {
+	var store *CredentialsStore
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	store.Protect("foo", next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !called {
+		t.Fatalf("nil store did not pass request through")
+	}
+}
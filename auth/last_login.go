@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// lastLogins records when each user last authenticated successfully, and last
+// did so explicitly. It has a lock of its own, so that recording a login does
+// not contend with the store's lock.
+type lastLogins struct {
+	mu       sync.Mutex
+	m        map[string]time.Time
+	explicit map[string]time.Time
+}
+
+// LastLogin returns the time username last passed Check, or any method which
+// calls it such as AA, and whether username has passed it at all since the
+// store was created.
+func (c *CredentialsStore) LastLogin(username string) (time.Time, bool) {
+	c.mu.RLock()
+	username = c.normalize(username)
+	c.mu.RUnlock()
+	c.lastLogins.mu.Lock()
+	defer c.lastLogins.mu.Unlock()
+	t, ok := c.lastLogins.m[username]
+	return t, ok
+}
+
+// lastExplicitLogin returns the time username last passed Check, CheckE or
+// CheckContext, and whether username has passed one at all.
+func (c *CredentialsStore) lastExplicitLogin(username string) (time.Time, bool) {
+	c.mu.RLock()
+	username = c.normalize(username)
+	c.mu.RUnlock()
+	c.lastLogins.mu.Lock()
+	defer c.lastLogins.mu.Unlock()
+	t, ok := c.lastLogins.explicit[username]
+	return t, ok
+}
+
+// recordLogin records that username has just authenticated successfully, and
+// if explicit is set, that it did so explicitly.
+func (c *CredentialsStore) recordLogin(username string, explicit bool) {
+	c.mu.RLock()
+	username = c.normalize(username)
+	c.mu.RUnlock()
+	now := c.now()
+	c.lastLogins.mu.Lock()
+	defer c.lastLogins.mu.Unlock()
+	if c.lastLogins.m == nil {
+		c.lastLogins.m = make(map[string]time.Time)
+	}
+	c.lastLogins.m[username] = now
+	if explicit {
+		if c.lastLogins.explicit == nil {
+			c.lastLogins.explicit = make(map[string]time.Time)
+		}
+		c.lastLogins.explicit[username] = now
+	}
+}
+
+// forgetLogin removes the record of username's last login.
+func (c *CredentialsStore) forgetLogin(username string) {
+	c.lastLogins.mu.Lock()
+	defer c.lastLogins.mu.Unlock()
+	delete(c.lastLogins.m, username)
+	delete(c.lastLogins.explicit, username)
+}
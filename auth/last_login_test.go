@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_AuthLastLogin(t *testing.T) {
+	store := NewCredentialsStore()
+	store.CaseInsensitive = true
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1", Perms: []string{"foo"}}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+
+	if _, ok := store.LastLogin("username1"); ok {
+		t.Fatalf("last login reported before any login")
+	}
+	store.Check("username1", "wrong")
+	if _, ok := store.LastLogin("username1"); ok {
+		t.Fatalf("last login recorded for failed check")
+	}
+
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated")
+	}
+	if got, ok := store.LastLogin("USERNAME1"); !ok || !got.Equal(now) {
+		t.Fatalf("wrong last login, exp %s, got %s (%v)", now, got, ok)
+	}
+
+	first := now
+	now = now.Add(time.Hour)
+	if !store.AA("username1", "password1", "foo") {
+		t.Fatalf("username1 not authorized")
+	}
+	if got, _ := store.LastLogin("username1"); !got.Equal(now) || got.Equal(first) {
+		t.Fatalf("last login not updated, exp %s, got %s", now, got)
+	}
+
+	store.RemoveUser("username1")
+	if _, ok := store.LastLogin("username1"); ok {
+		t.Fatalf("last login kept after user removed")
+	}
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrLockedOut is returned when a user is locked out due to repeated failed
+// authentication attempts.
+var ErrLockedOut = errors.New("user locked out")
+
+// LockoutPolicy configures locking out users after repeated failed attempts to
+// authenticate, blunting online password guessing.
+type LockoutPolicy struct {
+	// MaxFailures is the number of consecutive failed attempts, each within
+	// Window of the first, after which the user is locked out.
+	MaxFailures int
+
+	// Window is the period within which MaxFailures failed attempts must occur
+	// to trigger a lockout.
+	Window time.Duration
+
+	// Duration is how long a user remains locked out. While locked out, Check
+	// returns false for the user even if the correct password is supplied.
+	Duration time.Duration
+}
+
+// failureRecord tracks the failed authentication attempts of a single user.
+type failureRecord struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+// SetLockoutPolicy sets the policy used to lock out users after repeated failed
+// authentication attempts. Passing nil, or a policy whose MaxFailures is not
+// positive, disables lockout, which is the default. Any failed attempts
+// recorded so far are forgotten. Only users present in the store are tracked.
+// An attempt counts as failed from when it begins until it succeeds, so even
+// concurrent attempts, such as those made by CheckBatch, cannot verify more
+// than MaxFailures wrong passwords before the user is locked out. An attempt
+// abandoned because its context is done counts as failed.
+func (c *CredentialsStore) SetLockoutPolicy(p *LockoutPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = make(map[string]*failureRecord)
+	if p == nil || p.MaxFailures <= 0 {
+		c.lockout = nil
+		return
+	}
+	policy := *p
+	c.lockout = &policy
+}
+
+// IsLockedOut returns true if username is currently locked out due to repeated
+// failed authentication attempts.
+func (c *CredentialsStore) IsLockedOut(username string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.isLockedOut(c.normalize(username))
+}
+
+// isLockedOut returns true if username is currently locked out. The caller must
+// hold the read lock.
+func (c *CredentialsStore) isLockedOut(username string) bool {
+	if c.lockout == nil {
+		return false
+	}
+	f, ok := c.failures[username]
+	return ok && c.now().Before(f.lockedUntil)
+}
+
+// reserveAttempt returns false if username is locked out. Otherwise it counts
+// an attempt to authenticate username as failed before the password is
+// verified, locking the user out if the lockout policy's limit on failed
+// attempts has been reached, and returns true. Counting the attempt first
+// means concurrent attempts cannot all pass the lockout check before any has
+// failed, so no more than MaxFailures attempts are verified in a window. An
+// attempt which then succeeds is settled by resetAttempts.
+func (c *CredentialsStore) reserveAttempt(username string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lockout == nil {
+		return true
+	}
+	if c.isLockedOut(username) {
+		return false
+	}
+	if _, ok := c.store[username]; !ok {
+		return true
+	}
+
+	now := c.now()
+	f, ok := c.failures[username]
+	if !ok {
+		f = &failureRecord{}
+		c.failures[username] = f
+	}
+	if f.count == 0 || now.Sub(f.first) > c.lockout.Window {
+		f.count = 0
+		f.first = now
+	}
+	f.count++
+	if f.count >= c.lockout.MaxFailures {
+		f.count = 0
+		f.lockedUntil = now.Add(c.lockout.Duration)
+	}
+	return true
+}
+
+// resetAttempts records a successful attempt to authenticate username, which
+// resets the user's count of failures, and lifts any lockout its reservation
+// triggered.
+func (c *CredentialsStore) resetAttempts(username string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.failures, username)
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Lockout(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username1", "password": "password1", "perms": ["query"]},
+			{"username": "username2", "password": "password2", "perms": ["query"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	store.SetLockoutPolicy(&LockoutPolicy{
+		MaxFailures: 3,
+		Window:      time.Minute,
+		Duration:    10 * time.Minute,
+	})
+
+	// Failures spread beyond the window do not lock out.
+	store.Check("username1", "wrong")
+	store.Check("username1", "wrong")
+	now = now.Add(2 * time.Minute)
+	store.Check("username1", "wrong")
+	if store.IsLockedOut("username1") {
+		t.Fatalf("username1 locked out by failures outside window")
+	}
+
+	// A success resets the count.
+	store.Check("username1", "wrong")
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated")
+	}
+	store.Check("username1", "wrong")
+	store.Check("username1", "wrong")
+	if store.IsLockedOut("username1") {
+		t.Fatalf("username1 locked out despite intervening success")
+	}
+
+	store.Check("username1", "wrong")
+	if !store.IsLockedOut("username1") {
+		t.Fatalf("username1 not locked out")
+	}
+	if store.Check("username1", "password1") {
+		t.Fatalf("username1 authenticated while locked out")
+	}
+	if store.AA("username1", "password1", PermQuery) {
+		t.Fatalf("username1 authorized while locked out")
+	}
+	if store.IsLockedOut("username2") || !store.Check("username2", "password2") {
+		t.Fatalf("username2 affected by lockout of username1")
+	}
+
+	now = now.Add(10 * time.Minute)
+	if store.IsLockedOut("username1") {
+		t.Fatalf("username1 still locked out after lockout duration")
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated after lockout expired")
+	}
+}
+
+func Test_LockoutDisabled(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(`[{"username": "username1", "password": "password1"}]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	for i := 0; i < 10; i++ {
+		store.Check("username1", "wrong")
+	}
+	if store.IsLockedOut("username1") || !store.Check("username1", "password1") {
+		t.Fatalf("username1 locked out with no lockout policy")
+	}
+
+	store.SetLockoutPolicy(&LockoutPolicy{MaxFailures: 1, Duration: time.Hour})
+	store.Check("username1", "wrong")
+	if !store.IsLockedOut("username1") {
+		t.Fatalf("username1 not locked out")
+	}
+	store.SetLockoutPolicy(nil)
+	if store.IsLockedOut("username1") || !store.Check("username1", "password1") {
+		t.Fatalf("username1 locked out after lockout disabled")
+	}
+}
+
+// slowVerifier is a Verifier which counts its calls, each of which takes a
+// while, so that concurrent checks overlap.
+type slowVerifier struct {
+	calls atomic.Int64
+}
+
+func (v *slowVerifier) Verify(stored, given string) bool {
+	v.calls.Add(1)
+	time.Sleep(50 * time.Millisecond)
+	return stored == given
+}
+
+func Test_LockoutConcurrent(t *testing.T) {
+	store := NewCredentialsStore()
+	store.UseCache = false
+	if err := store.Load(strings.NewReader(`[{"username": "username1", "password": "password1"}]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	v := &slowVerifier{}
+	store.SetVerifier(v)
+	store.SetLockoutPolicy(&LockoutPolicy{
+		MaxFailures: 3,
+		Window:      time.Minute,
+		Duration:    time.Hour,
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Check("username1", "wrong")
+		}()
+	}
+	wg.Wait()
+
+	if exp, got := int64(3), v.calls.Load(); exp != got {
+		t.Fatalf("wrong number of passwords verified, exp %d, got %d", exp, got)
+	}
+	if !store.IsLockedOut("username1") {
+		t.Fatalf("username1 not locked out")
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import "fmt"
+
+// NewCredentialsStoreFromFiles returns a new instance of a CredentialStore,
+// holding the credentials loaded from each of the files, as if each were
+// loaded via NewCredentialsStoreFromFile and then merged via Merge.
+func NewCredentialsStoreFromFiles(paths ...string) (*CredentialsStore, error) {
+	c := NewCredentialsStore()
+	for _, path := range paths {
+		other, err := NewCredentialsStoreFromFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Merge(other); err != nil {
+			return nil, fmt.Errorf("%s in %s", err.Error(), path)
+		}
+	}
+	return c, nil
+}
+
+// Merge adds the users of other, with their passwords and perms, to the store.
+// The perms granted to AllUsers in either store are combined. If a user other
+// than AllUsers is present in both stores, an error is returned and the store
+// is left unchanged, unless MergeLastWins is set, in which case the user is
+// replaced by that of other. The users of other are checked as by Load, using
+// the settings of the store rather than of other, and if any is rejected an
+// error is returned and the store is left unchanged.
+func (c *CredentialsStore) Merge(other *CredentialsStore) error {
+	creds, err := c.maybeHashPlaintext(other.credentials())
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cred := range creds {
+		if err := c.checkCredential(cred); err != nil {
+			return err
+		}
+	}
+	if !c.MergeLastWins {
+		for _, cred := range creds {
+			if cred.Username == AllUsers {
+				continue
+			}
+			u := c.normalize(cred.Username)
+			_, inStore := c.store[u]
+			_, inPerms := c.perms[u]
+			if inStore || inPerms {
+				return fmt.Errorf("username %q present in both stores", cred.Username)
+			}
+		}
+	}
+
+	for _, cred := range creds {
+		if cred.Username != AllUsers {
+			c.putCredential(cred)
+			continue
+		}
+		m := c.perms
+		key := AllUsers
+		if cred.Tenant != "" {
+			m, key = c.tenantAllUsers, cred.Tenant
+		}
+		if m[key] == nil {
+			m[key] = make(PermSet, len(cred.Perms))
+		}
+		m[key].Add(cred.Perms...)
+		if key == AllUsers {
+			c.updateEffective(AllUsers)
+		}
+	}
+	return nil
+}
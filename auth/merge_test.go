@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustLoadStore(t *testing.T, s string) *CredentialsStore {
+	t.Helper()
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(s)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	return store
+}
+
+func Test_Merge(t *testing.T) {
+	store := mustLoadStore(t, `[
+		{"username": "alice", "password": "password1", "perms": ["query"]},
+		{"username": "*", "perms": ["status"]},
+		{"username": "*", "perms": ["ready"], "tenant": "a"}
+	]`)
+	other := mustLoadStore(t, `[
+		{"username": "bob", "password": "password2", "perms": ["execute"], "tenant": "a"},
+		{"username": "*", "perms": ["ready"]},
+		{"username": "*", "perms": ["backup"], "tenant": "a"}
+	]`)
+
+	if err := store.Merge(other); err != nil {
+		t.Fatalf("failed to merge: %s", err.Error())
+	}
+	if !store.Check("alice", "password1") || !store.HasPerm("alice", PermQuery) {
+		t.Fatalf("alice not present after merge")
+	}
+	if !store.Check("bob", "password2") || !store.HasTenantPerm("a", "bob", PermExecute) {
+		t.Fatalf("bob not merged")
+	}
+	if exp, got := []string{"ready", "status"}, store.perms[AllUsers].Slice(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong AllUsers perms, exp %v, got %v", exp, got)
+	}
+	if exp, got := []string{"backup", "ready"}, store.tenantAllUsers["a"].Slice(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong AllUsers perms for tenant a, exp %v, got %v", exp, got)
+	}
+}
+
+func Test_MergeConflict(t *testing.T) {
+	store := mustLoadStore(t, `[{"username": "alice", "password": "password1", "perms": ["query"]}]`)
+	other := mustLoadStore(t, `[
+		{"username": "bob", "password": "password2"},
+		{"username": "alice", "password": "password3", "perms": ["execute"]}
+	]`)
+
+	err := store.Merge(other)
+	if err == nil {
+		t.Fatalf("expected error merging conflicting user")
+	}
+	if exp, got := `username "alice" present in both stores`, err.Error(); exp != got {
+		t.Fatalf("wrong error, exp %q, got %q", exp, got)
+	}
+	if _, ok := store.Password("bob"); ok {
+		t.Fatalf("bob merged despite conflict")
+	}
+
+	store.MergeLastWins = true
+	if err := store.Merge(other); err != nil {
+		t.Fatalf("failed to merge with MergeLastWins: %s", err.Error())
+	}
+	if !store.Check("alice", "password3") || !store.HasPerm("alice", PermExecute) || store.HasPerm("alice", PermQuery) {
+		t.Fatalf("alice not replaced with MergeLastWins")
+	}
+}
+
+func Test_NewCredentialsStoreFromFiles(t *testing.T) {
+	path1 := mustWriteTempFile(t, `[{"username": "alice", "password": "password1"}, {"username": "*", "perms": ["status"]}]`)
+	path2 := mustWriteTempFile(t, `[{"username": "bob", "password": "password2"}, {"username": "*", "perms": ["ready"]}]`)
+
+	store, err := NewCredentialsStoreFromFiles(path1, path2)
+	if err != nil {
+		t.Fatalf("failed to load files: %s", err.Error())
+	}
+	if !store.Check("alice", "password1") || !store.Check("bob", "password2") {
+		t.Fatalf("users not loaded from both files")
+	}
+	if !store.HasPerm(AllUsers, PermStatus) || !store.HasPerm(AllUsers, PermReady) {
+		t.Fatalf("AllUsers perms not combined")
+	}
+
+	if _, err := NewCredentialsStoreFromFiles(path1, path1); err == nil {
+		t.Fatalf("expected error loading same users twice")
+	}
+}
+
+func Test_MergeRejected(t *testing.T) {
+	store := mustLoadStore(t, `[{"username": "alice", "password": "password1"}]`)
+	store.StrictPerms = true
+
+	other := NewCredentialsStore()
+	other.putCredential(Credential{Username: "ev:il", Password: "password2"})
+	err := store.Merge(other)
+	if err == nil || !strings.Contains(err.Error(), "contains a colon") {
+		t.Fatalf("wrong error merging bad username, got %v", err)
+	}
+
+	other = mustLoadStore(t, `[{"username": "bob", "password": "password2", "perms": ["nosuchperm"]}]`)
+	err = store.Merge(other)
+	if err == nil || !strings.Contains(err.Error(), `unknown perm "nosuchperm"`) {
+		t.Fatalf("wrong error merging unknown perm, got %v", err)
+	}
+	if exp, got := []string{"alice"}, store.Users(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("store modified by rejected merge, got users %v", got)
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// failureRateBuckets is the number of buckets the failure rate window is split
+// into. The window slides forward one bucket at a time.
+const failureRateBuckets = 10
+
+// failureRate counts failed checks across all users over a sliding window. It
+// is safe for concurrent use without locking. Buckets are recycled as the
+// window slides, and as a concurrent failure may be counted in a bucket just
+// before it is recycled, the count is approximate.
+type failureRate struct {
+	max       int64
+	bucketDur int64 // Nanoseconds.
+	now       func() time.Time
+	buckets   [failureRateBuckets]struct {
+		epoch int64
+		count int64
+	}
+}
+
+// record counts a failure at the current time.
+func (f *failureRate) record() {
+	e := f.now().UnixNano() / f.bucketDur
+	b := &f.buckets[e%failureRateBuckets]
+	if old := atomic.LoadInt64(&b.epoch); old != e && atomic.CompareAndSwapInt64(&b.epoch, old, e) {
+		atomic.StoreInt64(&b.count, 0)
+	}
+	atomic.AddInt64(&b.count, 1)
+}
+
+// count returns the number of failures within the window.
+func (f *failureRate) count() int64 {
+	e := f.now().UnixNano() / f.bucketDur
+	var n int64
+	for i := range f.buckets {
+		b := &f.buckets[i]
+		if e-atomic.LoadInt64(&b.epoch) < failureRateBuckets {
+			n += atomic.LoadInt64(&b.count)
+		}
+	}
+	return n
+}
+
+// SetFailureRateLimit sets the number of failed checks, across all users,
+// which may occur within window before Overloaded reports true. Unlike a
+// lockout policy, this guards the node against password spraying across many
+// usernames, for example by prompting the HTTP layer to answer 429 Too Many
+// Requests. A maxFailures or window which is not positive disables the limit,
+// which is the default. Any failures counted so far are forgotten.
+func (c *CredentialsStore) SetFailureRateLimit(maxFailures int, window time.Duration) {
+	if maxFailures <= 0 || window <= 0 {
+		c.failureRate.Store(nil)
+		return
+	}
+	c.failureRate.Store(&failureRate{
+		max:       int64(maxFailures),
+		bucketDur: max(int64(window)/failureRateBuckets, 1),
+		now:       c.now,
+	})
+}
+
+// Overloaded returns true if more failed checks than allowed by
+// SetFailureRateLimit have occurred within the window. It is always false if no
+// limit is set.
+func (c *CredentialsStore) Overloaded() bool {
+	f := c.failureRate.Load()
+	return f != nil && f.count() > f.max
+}
+
+// recordFailure counts a failed check towards the failure rate limit, if one
+// is set.
+func (c *CredentialsStore) recordFailure() {
+	if f := c.failureRate.Load(); f != nil {
+		f.record()
+	}
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_AuthOverloaded(t *testing.T) {
+	store := NewCredentialsStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	store.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1"}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+
+	// Disabled by default.
+	for i := 0; i < 10; i++ {
+		store.Check("username1", "wrong")
+	}
+	if store.Overloaded() {
+		t.Fatalf("overloaded with no limit set")
+	}
+
+	store.SetFailureRateLimit(3, 10*time.Second)
+	for i := 0; i < 3; i++ {
+		store.Check("username1", "wrong")
+		store.Check("username1", "password1")
+	}
+	if store.Overloaded() {
+		t.Fatalf("overloaded at limit")
+	}
+	store.Check("nosuchuser", "password1")
+	if !store.Overloaded() {
+		t.Fatalf("not overloaded above limit")
+	}
+
+	// Failures age out of the window.
+	advance(5 * time.Second)
+	if !store.Overloaded() {
+		t.Fatalf("not overloaded within window")
+	}
+	advance(6 * time.Second)
+	if store.Overloaded() {
+		t.Fatalf("still overloaded after window")
+	}
+
+	store.Check("username1", "wrong")
+	store.SetFailureRateLimit(0, 0)
+	if store.Overloaded() {
+		t.Fatalf("overloaded after limit removed")
+	}
+}
+
+func Test_AuthOverloadedConcurrent(t *testing.T) {
+	store := NewCredentialsStore()
+	store.SetFailureRateLimit(100, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				store.Check("nosuchuser", "password1")
+				store.Overloaded()
+			}
+		}()
+	}
+	wg.Wait()
+	if !store.Overloaded() {
+		t.Fatalf("not overloaded after concurrent failures")
+	}
+}
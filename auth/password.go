@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// maxArgon2idMemory is the most memory, in KiB, an Argon2id hash may require to
+// be verified. Hashes requiring more are rejected as malformed, rather than
+// allowing a single credential to exhaust memory.
+const maxArgon2idMemory = 1 << 20
+
+// ErrBadPassword is returned when the password supplied for a user is
+// incorrect.
+var ErrBadPassword = errors.New("bad password")
+
+// verifyPassword returns true if given is the password stored as stored.
+func verifyPassword(stored, given string) bool {
+	return comparePassword(stored, given) == nil
+}
+
+// comparePassword returns nil if given is the password stored as stored, and
+// ErrBadPassword if it is not. The format of stored is detected from its
+// prefix: bcrypt hashes start with $2a$, $2b$, or $2y$, and Argon2id hashes with
+// $argon2id$. Anything else is treated as a plaintext password. If stored has
+// the prefix of a hash but is malformed, an error describing why is returned.
+func comparePassword(stored, given string) error {
+	switch {
+	case isBcryptHash(stored):
+		err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(given))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return ErrBadPassword
+		} else if err != nil {
+			return fmt.Errorf("malformed bcrypt hash: %w", err)
+		}
+		return nil
+	case isArgon2idHash(stored):
+		return compareArgon2id(stored, given)
+	default:
+		if !constantTimeEqual(stored, given) {
+			return ErrBadPassword
+		}
+		return nil
+	}
+}
+
+// compareContext calls compare, such as comparePassword, with stored and given,
+// but returns ctx.Err() if ctx is done before the comparison completes. Unless
+// ctx can never be done, the comparison is performed in a new goroutine.
+func compareContext(ctx context.Context, compare func(stored, given string) error, stored, given string) error {
+	if ctx.Done() == nil {
+		return compare(stored, given)
+	}
+	ch := make(chan error, 1)
+	go func() {
+		ch <- compare(stored, given)
+	}()
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// constantTimeEqual returns true if a and b are equal. The time taken depends
+// on neither the contents nor the lengths of a and b, as both are hashed to a
+// fixed length before being compared.
+func constantTimeEqual(a, b string) bool {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+// hashPlaintext returns a copy of creds in which every non-empty password not
+// already hashed, as judged by isHashed, is replaced with a bcrypt hash of the
+// given cost. creds itself is not modified.
+func hashPlaintext(creds []Credential, cost int) ([]Credential, error) {
+	hash := func(pw string) (string, error) {
+		if pw == "" || isHashed(pw) {
+			return pw, nil
+		}
+		b, err := bcrypt.GenerateFromPassword([]byte(pw), cost)
+		return string(b), err
+	}
+
+	out := make([]Credential, len(creds))
+	for i, cred := range creds {
+		var err error
+		if cred.Password, err = hash(cred.Password); err != nil {
+			return nil, fmt.Errorf("hashing password of user %q: %w", cred.Username, err)
+		}
+		if cred.Passwords != nil {
+			pws := make([]string, len(cred.Passwords))
+			for j, pw := range cred.Passwords {
+				if pws[j], err = hash(pw); err != nil {
+					return nil, fmt.Errorf("hashing password of user %q: %w", cred.Username, err)
+				}
+			}
+			cred.Passwords = pws
+		}
+		out[i] = cred
+	}
+	return out, nil
+}
+
+// isHashed returns true if stored is a password hash in a recognized format.
+func isHashed(stored string) bool {
+	return isBcryptHash(stored) || isArgon2idHash(stored)
+}
+
+func isBcryptHash(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
+
+func isArgon2idHash(s string) bool {
+	return strings.HasPrefix(s, argon2idPrefix)
+}
+
+// compareArgon2id returns nil if given matches the Argon2id hash stored, which
+// must be in the standard encoding, e.g. $argon2id$v=19$m=65536,t=3,p=4$salt$hash,
+// with the salt and hash base64-encoded without padding.
+func compareArgon2id(stored, given string) error {
+	salt, hash, memory, time, threads, err := parseArgon2id(stored)
+	if err != nil {
+		return err
+	}
+	key := argon2.IDKey([]byte(given), salt, time, memory, threads, uint32(len(hash)))
+	if subtle.ConstantTimeCompare(key, hash) != 1 {
+		return ErrBadPassword
+	}
+	return nil
+}
+
+// parseArgon2id parses the Argon2id hash s, as described by compareArgon2id,
+// returning an error if it is malformed or its parameters are out of range.
+func parseArgon2id(s string) (salt, hash []byte, memory, time uint32, threads uint8, err error) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, 0, 0, 0, fmt.Errorf("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, 0, 0, 0, fmt.Errorf("malformed argon2id version: %w", err)
+	}
+	if version != argon2.Version {
+		return nil, nil, 0, 0, 0, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return nil, nil, 0, 0, 0, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+	if time < 1 || threads < 1 {
+		return nil, nil, 0, 0, 0, fmt.Errorf("malformed argon2id parameters: t and p must be at least 1")
+	}
+	if memory > maxArgon2idMemory {
+		return nil, nil, 0, 0, 0, fmt.Errorf("malformed argon2id parameters: m exceeds maximum of %d", maxArgon2idMemory)
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, nil, 0, 0, 0, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	if hash, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, nil, 0, 0, 0, fmt.Errorf("malformed argon2id hash: %w", err)
+	}
+	if len(hash) == 0 {
+		return nil, nil, 0, 0, 0, fmt.Errorf("malformed argon2id hash: empty key")
+	}
+	return salt, hash, memory, time, threads, nil
+}
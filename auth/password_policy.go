@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// PasswordPolicy sets the minimum complexity of plaintext passwords accepted by
+// AddUser. Hashed passwords cannot be inspected, so are always accepted. The
+// zero value accepts any password.
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters in a password.
+	MinLength int
+
+	// RequireUpper, RequireLower, RequireDigit and RequireSymbol require a
+	// password to contain at least one uppercase letter, lowercase letter,
+	// digit, or symbol respectively. A symbol is any character which is not a
+	// letter, digit or space.
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+
+	// RejectUsername rejects a password equal to the username of its user,
+	// ignoring case. As Check is not given the username, it is applied only
+	// by CheckUser, and so by AddUser.
+	RejectUsername bool
+
+	// MaxSequential, if positive, rejects a password containing a run of more
+	// than MaxSequential characters each one greater, or each one less, than
+	// the one before, such as "abcd" or "4321".
+	MaxSequential int
+}
+
+// Check returns an error describing how password falls short of the policy, or
+// nil if it complies. A nil policy accepts any password.
+func (p *PasswordPolicy) Check(password string) error {
+	if p == nil {
+		return nil
+	}
+	if n := len([]rune(password)); n < p.MinLength {
+		return fmt.Errorf("password has %d characters, need at least %d", n, p.MinLength)
+	}
+	if p.MaxSequential > 0 {
+		if n := longestSequence(password); n > p.MaxSequential {
+			return fmt.Errorf("password has %d sequential characters, at most %d allowed", n, p.MaxSequential)
+		}
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r) && !unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	switch {
+	case p.RequireUpper && !upper:
+		return errors.New("password needs an uppercase letter")
+	case p.RequireLower && !lower:
+		return errors.New("password needs a lowercase letter")
+	case p.RequireDigit && !digit:
+		return errors.New("password needs a digit")
+	case p.RequireSymbol && !symbol:
+		return errors.New("password needs a symbol")
+	}
+	return nil
+}
+
+// CheckUser is like Check, but also applies the checks which need the username
+// of the password's user.
+func (p *PasswordPolicy) CheckUser(username, password string) error {
+	if p == nil {
+		return nil
+	}
+	if p.RejectUsername && strings.EqualFold(password, username) {
+		return errors.New("password equals username")
+	}
+	return p.Check(password)
+}
+
+// longestSequence returns the length of the longest run of characters in s each
+// one greater, or each one less, than the one before.
+func longestSequence(s string) int {
+	longest, up, down := 0, 0, 0
+	var prev rune
+	for i, r := range []rune(s) {
+		switch {
+		case i > 0 && r == prev+1:
+			up, down = up+1, 1
+		case i > 0 && r == prev-1:
+			up, down = 1, down+1
+		default:
+			up, down = 1, 1
+		}
+		longest = max(longest, up, down)
+		prev = r
+	}
+	return longest
+}
+
+// checkPasswordPolicy returns an error if any plaintext password of cred does
+// not comply with p.
+func checkPasswordPolicy(p *PasswordPolicy, cred Credential) error {
+	if p == nil || cred.Username == AllUsers || cred.Username == AuthedUsers {
+		return nil
+	}
+	pws := cred.Passwords
+	if cred.Password != "" || len(pws) == 0 {
+		pws = append([]string{cred.Password}, pws...)
+	}
+	for _, pw := range pws {
+		if isHashed(pw) {
+			continue
+		}
+		if err := p.CheckUser(cred.Username, pw); err != nil {
+			return fmt.Errorf("weak password for user %q: %w", cred.Username, err)
+		}
+	}
+	return nil
+}
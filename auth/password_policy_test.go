@@ -0,0 +1,106 @@
+package auth
+
+import "testing"
+
+func Test_PasswordPolicyCheck(t *testing.T) {
+	p := &PasswordPolicy{
+		MinLength:     8,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	}
+	for _, tt := range []struct {
+		password string
+		ok       bool
+	}{
+		{"Passw0rd!", true},
+		{"Pa0!", false},
+		{"password0!", false},
+		{"PASSWORD0!", false},
+		{"Password!!", false},
+		{"Password00", false},
+	} {
+		if err := p.Check(tt.password); (err == nil) != tt.ok {
+			t.Fatalf("wrong result for %q, exp ok %v, got error %v", tt.password, tt.ok, err)
+		}
+	}
+
+	var nilPolicy *PasswordPolicy
+	if err := nilPolicy.Check(""); err != nil {
+		t.Fatalf("nil policy rejected password: %s", err.Error())
+	}
+	if err := (&PasswordPolicy{}).Check(""); err != nil {
+		t.Fatalf("zero policy rejected password: %s", err.Error())
+	}
+}
+
+func Test_PasswordPolicyHeuristics(t *testing.T) {
+	p := &PasswordPolicy{RejectUsername: true, MaxSequential: 3}
+	for _, tt := range []struct {
+		password string
+		ok       bool
+	}{
+		{"Username1", false},
+		{"USERNAME1", false},
+		{"username12", true},
+		{"xabcx", true},
+		{"xabcdx", false},
+		{"x4321x", false},
+		{"a1b2c3d4", true},
+		{"aaaa", true},
+		{"", true},
+	} {
+		if err := p.CheckUser("username1", tt.password); (err == nil) != tt.ok {
+			t.Fatalf("wrong result for %q, exp ok %v, got error %v", tt.password, tt.ok, err)
+		}
+	}
+
+	// Check alone cannot tell if the password equals the username.
+	if err := p.Check("username1"); err != nil {
+		t.Fatalf("Check rejected password: %s", err.Error())
+	}
+}
+
+func Test_AuthAddUserPasswordHeuristics(t *testing.T) {
+	store := NewCredentialsStore()
+	store.PasswordPolicy = &PasswordPolicy{RejectUsername: true, MaxSequential: 3}
+
+	if err := store.AddUser(Credential{Username: "username1", Password: "username1"}); err == nil {
+		t.Fatalf("expected error adding user with password equal to username")
+	} else if exp := `weak password for user "username1": password equals username`; err.Error() != exp {
+		t.Fatalf("wrong error, exp %q, got %q", exp, err.Error())
+	}
+	if err := store.AddUser(Credential{Username: "username1", Password: "pass12345"}); err == nil {
+		t.Fatalf("expected error adding user with sequential password")
+	}
+	if err := store.AddUser(Credential{Username: "username1", Password: "pass1357"}); err != nil {
+		t.Fatalf("failed to add user with compliant password: %s", err.Error())
+	}
+}
+
+func Test_AuthAddUserPasswordPolicy(t *testing.T) {
+	store := NewCredentialsStore()
+	store.PasswordPolicy = &PasswordPolicy{MinLength: 8, RequireDigit: true}
+
+	if err := store.AddUser(Credential{Username: "username1", Password: "short1"}); err == nil {
+		t.Fatalf("expected error adding user with short password")
+	}
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1", Passwords: []string{"password"}}); err == nil {
+		t.Fatalf("expected error adding user with weak further password")
+	}
+	if store.Check("username1", "password1") {
+		t.Fatalf("username1 added despite policy violation")
+	}
+
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1"}); err != nil {
+		t.Fatalf("failed to add user with compliant password: %s", err.Error())
+	}
+	// Hashes cannot be inspected, so are accepted regardless of the policy.
+	if err := store.AddUser(Credential{Username: "username2", Password: mustBcrypt(t, "weak")}); err != nil {
+		t.Fatalf("failed to add user with hashed password: %s", err.Error())
+	}
+	if err := store.AddUser(Credential{Username: AllUsers, Perms: []string{"status"}}); err != nil {
+		t.Fatalf("failed to add AllUsers: %s", err.Error())
+	}
+}
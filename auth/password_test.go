@@ -0,0 +1,719 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func Test_VerifyPassword(t *testing.T) {
+	bcryptHash := mustBcrypt(t, "password1")
+	argonHash := mustArgon2id(t, "password1")
+
+	for _, tt := range []struct {
+		name   string
+		stored string
+		given  string
+		exp    bool
+	}{
+		{"plaintext match", "password1", "password1", true},
+		{"plaintext mismatch", "password1", "password2", false},
+		{"bcrypt match", bcryptHash, "password1", true},
+		{"bcrypt mismatch", bcryptHash, "password2", false},
+		{"bcrypt 2b match", "$2b$" + strings.TrimPrefix(bcryptHash, "$2a$"), "password1", true},
+		{"argon2id match", argonHash, "password1", true},
+		{"argon2id mismatch", argonHash, "password2", false},
+		{"argon2id malformed", "$argon2id$v=19$m=64,t=1,p=1$!!!$!!!", "password1", false},
+		{"argon2id wrong version", strings.Replace(argonHash, "v=19", "v=16", 1), "password1", false},
+		{"argon2id truncated", "$argon2id$v=19$m=64,t=1,p=1", "password1", false},
+		{"argon2id zero time", strings.Replace(argonHash, "t=1", "t=0", 1), "password1", false},
+		{"argon2id zero threads", strings.Replace(argonHash, "p=1", "p=0", 1), "password1", false},
+		{"argon2id huge memory", strings.Replace(argonHash, "m=64", "m=4294967295", 1), "password1", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPassword(tt.stored, tt.given); got != tt.exp {
+				t.Fatalf("wrong result, exp %v, got %v", tt.exp, got)
+			}
+		})
+	}
+}
+
+func Test_ConstantTimeEqual(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		exp  bool
+	}{
+		{"", "", true},
+		{"password1", "password1", true},
+		{"password1", "password2", false},
+		{"password1", "password", false},
+		{"password", "password1", false},
+		{"", "password1", false},
+	} {
+		if got := constantTimeEqual(tt.a, tt.b); got != tt.exp {
+			t.Fatalf("wrong result for %q and %q, exp %v, got %v", tt.a, tt.b, tt.exp, got)
+		}
+	}
+}
+
+func Test_AuthHashedPasswords(t *testing.T) {
+	jsonStream := fmt.Sprintf(`
+		[
+			{"username": "username1", "password": %q, "perms": ["foo"]},
+			{"username": "username2", "password": %q, "perms": ["foo"]},
+			{"username": "username3", "password": "password3", "perms": ["foo"]}
+		]
+	`, mustBcrypt(t, "password1"), mustArgon2id(t, "password2"))
+
+	for _, useCache := range []bool{false, true} {
+		store := NewCredentialsStore()
+		store.UseCache = useCache
+		if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+			t.Fatalf("failed to load credentials: %s", err.Error())
+		}
+
+		// Check twice, so the cached path is exercised.
+		for i := 0; i < 2; i++ {
+			if !store.Check("username1", "password1") {
+				t.Fatalf("bcrypt user not authenticated (cache %v)", useCache)
+			}
+			if store.Check("username1", "wrong") {
+				t.Fatalf("bcrypt user authenticated with wrong password (cache %v)", useCache)
+			}
+			if !store.AA("username2", "password2", "foo") {
+				t.Fatalf("argon2id user not authorized (cache %v)", useCache)
+			}
+			if store.Check("username2", "wrong") {
+				t.Fatalf("argon2id user authenticated with wrong password (cache %v)", useCache)
+			}
+			if !store.Check("username3", "password3") {
+				t.Fatalf("plaintext user not authenticated (cache %v)", useCache)
+			}
+		}
+
+		// The stored hash itself is only accepted if AllowHashLogin is set.
+		pw, _ := store.Password("username1")
+		if store.Check("username1", pw) {
+			t.Fatalf("bcrypt user authenticated with stored hash (cache %v)", useCache)
+		}
+		if store.AA("username1", pw, "foo") {
+			t.Fatalf("bcrypt user authorized with stored hash (cache %v)", useCache)
+		}
+		if !store.AAFromNode("username1", pw, "foo") {
+			t.Fatalf("bcrypt user not authorized from node with stored hash (cache %v)", useCache)
+		}
+		if store.AAFromNode("username1", "wrong", "foo") {
+			t.Fatalf("bcrypt user authorized from node with wrong password (cache %v)", useCache)
+		}
+		if store.AAFromNode("username3", "wrong", "foo") {
+			t.Fatalf("plaintext user authorized from node with wrong password (cache %v)", useCache)
+		}
+		store.AllowHashLogin = true
+		if !store.Check("username1", pw) {
+			t.Fatalf("bcrypt user not authenticated with stored hash (cache %v)", useCache)
+		}
+		if !store.Check("username1", "password1") {
+			t.Fatalf("bcrypt user not authenticated with AllowHashLogin set (cache %v)", useCache)
+		}
+		if store.Check("username3", "wrong") {
+			t.Fatalf("plaintext user authenticated with wrong password (cache %v)", useCache)
+		}
+	}
+}
+
+func Test_AuthHashedPasswordCacheStale(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.Upsert(Credential{Username: "username1", Password: mustBcrypt(t, "password1")}); err != nil {
+		t.Fatalf("failed to upsert: %s", err.Error())
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated")
+	}
+
+	// A cached verification must not outlive a change of the stored password.
+	if err := store.Upsert(Credential{Username: "username1", Password: mustBcrypt(t, "password2")}); err != nil {
+		t.Fatalf("failed to upsert: %s", err.Error())
+	}
+	if store.Check("username1", "password1") {
+		t.Fatalf("username1 authenticated with old password after change")
+	}
+	if !store.Check("username1", "password2") {
+		t.Fatalf("username1 not authenticated with new password")
+	}
+}
+
+func Test_AuthAddUserInvalidatesCache(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.AddUser(Credential{Username: "username1", Password: mustBcrypt(t, "password1")}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated")
+	}
+	pw, _ := store.Password("username1")
+	if !store.hashCache.Check("username1", cacheKey(pw, "password1")) {
+		t.Fatalf("verification not cached")
+	}
+
+	if err := store.AddUser(Credential{Username: "username1", Password: mustBcrypt(t, "password2")}); err != nil {
+		t.Fatalf("failed to update user: %s", err.Error())
+	}
+	if store.hashCache.Check("username1", cacheKey(pw, "password1")) {
+		t.Fatalf("stale verification still cached after password change")
+	}
+	if store.Check("username1", "password1") {
+		t.Fatalf("username1 authenticated with old password")
+	}
+}
+
+func Test_AuthReloadInvalidatesCache(t *testing.T) {
+	store := NewCredentialsStore()
+	old := mustBcrypt(t, "password1")
+	if err := store.Load(strings.NewReader(`[{"username": "username1", "password": "` + old + `"}, {"username": "username2", "password": "` + old + `"}]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	for _, u := range []string{"username1", "username2"} {
+		if !store.Check(u, "password1") {
+			t.Fatalf("%s not authenticated", u)
+		}
+	}
+
+	// Rotate the password of username1, and remove username2.
+	if err := store.Reload(strings.NewReader(`[{"username": "username1", "password": "` + mustBcrypt(t, "password2") + `"}]`)); err != nil {
+		t.Fatalf("failed to reload credentials: %s", err.Error())
+	}
+	for _, u := range []string{"username1", "username2"} {
+		if store.hashCache.Check(u, cacheKey(old, "password1")) {
+			t.Fatalf("stale verification of %s still cached after reload", u)
+		}
+	}
+	if store.Check("username1", "password1") {
+		t.Fatalf("username1 authenticated with old password after reload")
+	}
+	if !store.Check("username1", "password2") {
+		t.Fatalf("username1 not authenticated with new password after reload")
+	}
+}
+
+func Test_AuthSetVerifierClearsCache(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.AddUser(Credential{Username: "username1", Password: mustBcrypt(t, "password1")}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated")
+	}
+	store.SetVerifier(DefaultVerifier)
+	if exp, got := 0, store.hashCache.Len(); exp != got {
+		t.Fatalf("cache not cleared by SetVerifier, exp length %d, got %d", exp, got)
+	}
+}
+
+func Test_AuthSetHashCache(t *testing.T) {
+	store := NewCredentialsStore()
+	hc := NewHashCacheWithSize(1)
+	store.SetHashCache(hc)
+	for _, u := range []string{"username1", "username2"} {
+		if err := store.AddUser(Credential{Username: u, Password: mustBcrypt(t, "password1")}); err != nil {
+			t.Fatalf("failed to add user: %s", err.Error())
+		}
+		if !store.Check(u, "password1") {
+			t.Fatalf("%s not authenticated", u)
+		}
+	}
+	if exp, got := 1, hc.Len(); exp != got {
+		t.Fatalf("wrong cache length, exp %d, got %d", exp, got)
+	}
+}
+
+func Test_AuthHashCacheTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	hc := NewHashCache(WithTTL(time.Minute), WithClock(func() time.Time { return now }))
+
+	store := NewCredentialsStore()
+	store.SetHashCache(hc)
+	if err := store.AddUser(Credential{Username: "username1", Password: mustBcrypt(t, "password1")}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	pw, _ := store.Password("username1")
+	key := cacheKey(pw, "password1")
+
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated")
+	}
+	if !hc.Check("username1", key) {
+		t.Fatalf("verification not cached")
+	}
+
+	now = now.Add(time.Minute)
+	if hc.Check("username1", key) {
+		t.Fatalf("verification still cached after TTL")
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated after cache expiry")
+	}
+	if !hc.Check("username1", key) {
+		t.Fatalf("verification not cached again after expiry")
+	}
+}
+
+func Test_AuthNegativeHashCache(t *testing.T) {
+	store := NewCredentialsStore()
+	store.UseCache = false
+	neg := NewHashCache(WithTTL(time.Minute))
+	store.SetNegativeHashCache(neg)
+	if err := store.AddUser(Credential{Username: "username1", Password: mustBcrypt(t, "password1")}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+
+	for i := 0; i < 3; i++ {
+		if store.Check("username1", "wrong") {
+			t.Fatalf("username1 authenticated with wrong password")
+		}
+	}
+	st := store.Stats()
+	if exp, got := int64(1), st.HashComputations; exp != got {
+		t.Fatalf("wrong number of hash computations, exp %d, got %d", exp, got)
+	}
+	if exp, got := int64(2), st.NegativeCacheHits; exp != got {
+		t.Fatalf("wrong number of negative cache hits, exp %d, got %d", exp, got)
+	}
+
+	// The correct password must not be affected by the negative cache.
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated")
+	}
+	if exp, got := 1, neg.Len(); exp != got {
+		t.Fatalf("wrong negative cache length, exp %d, got %d", exp, got)
+	}
+
+	// A failed verification must not outlive a change of the stored password.
+	if err := store.AddUser(Credential{Username: "username1", Password: mustBcrypt(t, "wrong")}); err != nil {
+		t.Fatalf("failed to update user: %s", err.Error())
+	}
+	if exp, got := 0, neg.Len(); exp != got {
+		t.Fatalf("negative cache not invalidated, exp length %d, got %d", exp, got)
+	}
+	if !store.Check("username1", "wrong") {
+		t.Fatalf("username1 not authenticated with new password")
+	}
+}
+
+func Test_AuthNegativeHashCacheDisabled(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.AddUser(Credential{Username: "username1", Password: mustBcrypt(t, "password1")}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	for i := 0; i < 2; i++ {
+		if store.Check("username1", "wrong") {
+			t.Fatalf("username1 authenticated with wrong password")
+		}
+	}
+	if exp, got := int64(2), store.Stats().HashComputations; exp != got {
+		t.Fatalf("wrong number of hash computations, exp %d, got %d", exp, got)
+	}
+}
+
+func Test_AuthRehashCost(t *testing.T) {
+	hashed := mustBcrypt(t, "password1")
+	store := NewCredentialsStore()
+	store.RehashCost = bcrypt.MinCost + 1
+	for _, cred := range []Credential{
+		{Username: "username1", Password: hashed},
+		{Username: "username2", Password: "password2"},
+	} {
+		if err := store.AddUser(cred); err != nil {
+			t.Fatalf("failed to add user: %s", err.Error())
+		}
+	}
+
+	if store.Check("username1", "wrong") {
+		t.Fatalf("username1 authenticated with wrong password")
+	}
+	if pw, _ := store.Password("username1"); pw != hashed {
+		t.Fatalf("hash upgraded after failed check")
+	}
+
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated")
+	}
+	pw, _ := store.Password("username1")
+	if pw == hashed {
+		t.Fatalf("hash not upgraded after successful check")
+	}
+	if cost, err := bcrypt.Cost([]byte(pw)); err != nil || cost != store.RehashCost {
+		t.Fatalf("wrong cost for upgraded hash, exp %d, got %d (%v)", store.RehashCost, cost, err)
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated with upgraded hash")
+	}
+	if store.Check("username1", "wrong") {
+		t.Fatalf("username1 authenticated with wrong password after upgrade")
+	}
+
+	// A hash at the target cost is left alone.
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated")
+	}
+	if pw2, _ := store.Password("username1"); pw2 != pw {
+		t.Fatalf("hash at target cost was rehashed")
+	}
+
+	// Plaintext passwords are never hashed.
+	if !store.Check("username2", "password2") {
+		t.Fatalf("username2 not authenticated")
+	}
+	if pw, _ := store.Password("username2"); pw != "password2" {
+		t.Fatalf("plaintext password was rehashed")
+	}
+}
+
+func Test_AuthCheckContext(t *testing.T) {
+	b, err := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatalf("failed to generate bcrypt hash: %s", err.Error())
+	}
+	store := NewCredentialsStore()
+	for _, cred := range []Credential{
+		{Username: "username1", Password: string(b)},
+		{Username: "username2", Password: "password2"},
+	} {
+		if err := store.AddUser(cred); err != nil {
+			t.Fatalf("failed to add user: %s", err.Error())
+		}
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ok, err := store.CheckContext(canceled, "username1", "password1")
+	if ok || err != context.Canceled {
+		t.Fatalf("expected cancellation of hash computation, got %v, %v", ok, err)
+	}
+
+	// Plaintext checks need no hash computation, so complete anyway.
+	ok, err = store.CheckContext(canceled, "username2", "password2")
+	if !ok || err != nil {
+		t.Fatalf("plaintext check failed with canceled context: %v, %v", ok, err)
+	}
+
+	ok, err = store.CheckContext(context.Background(), "username1", "password1")
+	if !ok || err != nil {
+		t.Fatalf("username1 not authenticated: %v, %v", ok, err)
+	}
+
+	// The verification is now cached, so completes anyway.
+	ok, err = store.CheckContext(canceled, "username1", "password1")
+	if !ok || err != nil {
+		t.Fatalf("cached check failed with canceled context: %v, %v", ok, err)
+	}
+}
+
+func Test_AuthCheckE(t *testing.T) {
+	store := NewCredentialsStore()
+	for _, cred := range []Credential{
+		{Username: "username1", Password: mustBcrypt(t, "password1")},
+		{Username: "username2", Password: "password2"},
+		{Username: "username3", Password: "$2a$10$corrupt"},
+		{Username: "username4", Password: "$argon2id$v=19$corrupt"},
+		{Username: "username5", Password: "password5"},
+	} {
+		if err := store.AddUser(cred); err != nil {
+			t.Fatalf("failed to add user: %s", err.Error())
+		}
+	}
+	store.SetAuthGate(func(username string) bool { return username != "username5" })
+
+	for _, tt := range []struct {
+		username string
+		password string
+		exp      bool
+		expErr   error
+	}{
+		{"username1", "password1", true, nil},
+		{"username1", "wrong", false, ErrBadPassword},
+		{"username2", "password2", true, nil},
+		{"username2", "wrong", false, ErrBadPassword},
+		{"nobody", "password1", false, ErrUserNotFound},
+		{"username5", "password5", false, ErrDeniedByGate},
+	} {
+		ok, err := store.CheckE(tt.username, tt.password)
+		if ok != tt.exp || err != tt.expErr {
+			t.Fatalf("CheckE(%q, %q) = %v, %v, exp %v, %v", tt.username, tt.password, ok, err, tt.exp, tt.expErr)
+		}
+		if got := store.Check(tt.username, tt.password); got != tt.exp {
+			t.Fatalf("Check(%q, %q) = %v, exp %v", tt.username, tt.password, got, tt.exp)
+		}
+	}
+
+	// Malformed hashes are reported as such, not as bad passwords.
+	for _, u := range []string{"username3", "username4"} {
+		ok, err := store.CheckE(u, "password")
+		if ok || err == nil || err == ErrBadPassword {
+			t.Fatalf("CheckE(%q) = %v, %v, exp malformed hash error", u, ok, err)
+		}
+	}
+	if _, err := store.CheckE("username3", "password"); !errors.Is(err, bcrypt.ErrHashTooShort) {
+		t.Fatalf("malformed bcrypt hash error does not wrap bcrypt error: %v", err)
+	}
+
+	store.SetLockoutPolicy(&LockoutPolicy{MaxFailures: 1, Duration: time.Hour})
+	store.Check("username2", "wrong")
+	if ok, err := store.CheckE("username2", "password2"); ok || err != ErrLockedOut {
+		t.Fatalf("CheckE of locked out user = %v, %v, exp false, %v", ok, err, ErrLockedOut)
+	}
+}
+
+func Test_AuthMultiplePasswordsHashed(t *testing.T) {
+	store := NewCredentialsStore()
+	hc := NewHashCache()
+	store.SetHashCache(hc)
+	oldHash, newHash := mustBcrypt(t, "old"), mustBcrypt(t, "new")
+	if err := store.AddUser(Credential{Username: "username1", Passwords: []string{oldHash, newHash}}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+
+	if !store.Check("username1", "old") || !store.Check("username1", "new") {
+		t.Fatalf("both passwords not valid during overlap")
+	}
+	if store.Check("username1", "wrong") {
+		t.Fatalf("wrong password accepted")
+	}
+	if !hc.Check("username1", cacheKey(oldHash, "old")) || !hc.Check("username1", cacheKey(newHash, "new")) {
+		t.Fatalf("matched hashes not cached")
+	}
+}
+
+func Test_AuthValidateOnLoad(t *testing.T) {
+	hashed := mustBcrypt(t, "password1")
+	argonHash := mustArgon2id(t, "password1")
+	for _, tt := range []struct {
+		cred   string
+		expErr string
+	}{
+		{`{"username": "username1", "password": "` + hashed + `"}`, ""},
+		{`{"username": "username1", "passwords": ["password1"]}`, ""},
+		{`{"username": "*", "perms": ["status"]}`, ""},
+		{`{"username": "username1"}`, `empty password for user "username1"`},
+		{`{"username": "username1", "password": "` + hashed[:20] + `"}`,
+			`invalid bcrypt hash for user "username1": crypto/bcrypt: hashedSecret too short to be a bcrypted password`},
+		{`{"username": "username1", "password": "password1", "passwords": ["$2a$xx$abc"]}`,
+			`invalid bcrypt hash for user "username1"`},
+		{`{"username": "username1", "password": "` + argonHash + `"}`, ""},
+		{`{"username": "username1", "password": "` + strings.Replace(argonHash, "t=1", "t=0", 1) + `"}`,
+			`invalid argon2id hash for user "username1": malformed argon2id parameters`},
+		{`{"username": "username1", "password": "` + strings.Replace(argonHash, "p=1", "p=0", 1) + `"}`,
+			`invalid argon2id hash for user "username1": malformed argon2id parameters`},
+	} {
+		jsonStream := `[{"username": "username0", "password": "password0"}, ` + tt.cred + `]`
+
+		store := NewCredentialsStore()
+		if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+			t.Fatalf("failed to load %s without ValidateOnLoad: %s", tt.cred, err.Error())
+		}
+
+		store = NewCredentialsStore()
+		store.ValidateOnLoad = true
+		err := store.Load(strings.NewReader(jsonStream))
+		if tt.expErr == "" {
+			if err != nil {
+				t.Fatalf("failed to load %s: %s", tt.cred, err.Error())
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("expected error loading %s", tt.cred)
+		}
+		if !strings.HasPrefix(err.Error(), tt.expErr) || !strings.HasSuffix(err.Error(), "at index 1") {
+			t.Fatalf("wrong error loading %s, exp %q, got %q", tt.cred, tt.expErr, err.Error())
+		}
+		if _, ok := store.Password("username0"); ok {
+			t.Fatalf("credentials loaded despite error")
+		}
+	}
+}
+
+func mustBcrypt(t *testing.T, password string) string {
+	t.Helper()
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to generate bcrypt hash: %s", err.Error())
+	}
+	return string(b)
+}
+
+func mustArgon2id(t *testing.T, password string) string {
+	t.Helper()
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		t.Fatalf("failed to generate salt: %s", err.Error())
+	}
+	const memory, time, threads = 64, 1, 1
+	key := argon2.IDKey([]byte(password), salt, time, memory, threads, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, memory, time, threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func Test_AuthHashPlaintextOnLoad(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"passwords": ["password2"],
+				"perms": ["foo"]
+			},
+			{
+				"username": "*",
+				"perms": ["bar"]
+			}
+		]
+	`
+
+	store := NewCredentialsStore()
+	store.HashPlaintextOnLoad = true
+	store.HashPlaintextCost = bcrypt.MinCost
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	for _, cred := range store.credentials() {
+		for _, pw := range append([]string{cred.Password}, cred.Passwords...) {
+			if pw != "" && !isBcryptHash(pw) {
+				t.Fatalf("plaintext password stored for %s", cred.Username)
+			}
+		}
+	}
+	pw, _ := store.Password("username1")
+	if cost, err := bcrypt.Cost([]byte(pw)); err != nil || cost != bcrypt.MinCost {
+		t.Fatalf("wrong cost of stored hash, exp %d, got %d (%v)", bcrypt.MinCost, cost, err)
+	}
+	if !store.Check("username1", "password1") || !store.Check("username1", "password2") {
+		t.Fatalf("username1 not authenticated after hashing")
+	}
+	if store.Check("username1", "password3") {
+		t.Fatalf("username1 authenticated with wrong password after hashing")
+	}
+
+	// Reload must hash too, leaving existing hashes untouched.
+	hash := mustBcrypt(t, "password4")
+	if err := store.Reload(strings.NewReader(`[{"username": "username2", "password": "password5"}, {"username": "username3", "password": "` + hash + `"}]`)); err != nil {
+		t.Fatalf("failed to reload credentials: %s", err.Error())
+	}
+	if pw, _ := store.Password("username2"); !isBcryptHash(pw) {
+		t.Fatalf("plaintext password stored for username2 after reload")
+	}
+	if pw, _ := store.Password("username3"); pw != hash {
+		t.Fatalf("existing hash of username3 replaced")
+	}
+	if !store.Check("username2", "password5") {
+		t.Fatalf("username2 not authenticated after reload")
+	}
+}
+
+func Test_AuthHashPlaintextOnLoadFormats(t *testing.T) {
+	src := mustLoadStore(t, `[{"username": "username1", "password": "password1"}]`)
+	var bin bytes.Buffer
+	if err := src.SaveBinary(&bin); err != nil {
+		t.Fatalf("failed to save binary: %s", err.Error())
+	}
+
+	for name, load := range map[string]func(*CredentialsStore) error{
+		"CSV": func(s *CredentialsStore) error {
+			return s.LoadCSV(strings.NewReader("username,password,perms\nusername1,password1,query\n"))
+		},
+		"binary": func(s *CredentialsStore) error {
+			return s.LoadBinary(bytes.NewReader(bin.Bytes()))
+		},
+		"merge": func(s *CredentialsStore) error {
+			return s.Merge(src)
+		},
+	} {
+		store := NewCredentialsStore()
+		store.HashPlaintextOnLoad = true
+		store.HashPlaintextCost = bcrypt.MinCost
+		if err := load(store); err != nil {
+			t.Fatalf("failed to load %s credentials: %s", name, err.Error())
+		}
+		if pw, _ := store.Password("username1"); !isBcryptHash(pw) {
+			t.Fatalf("plaintext password stored for username1 loaded from %s", name)
+		}
+		if !store.Check("username1", "password1") {
+			t.Fatalf("username1 loaded from %s not authenticated after hashing", name)
+		}
+	}
+}
+
+func Test_AuthHashPlaintextOnLoadAddUser(t *testing.T) {
+	store := NewCredentialsStore()
+	store.HashPlaintextOnLoad = true
+	store.HashPlaintextCost = bcrypt.MinCost
+	store.PasswordPolicy = &PasswordPolicy{MinLength: 8}
+	if err := store.AddUser(Credential{Username: "username1", Password: "short"}); err == nil {
+		t.Fatalf("weak password accepted")
+	}
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1"}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	if err := store.Upsert(Credential{Username: "username2", Passwords: []string{"password2", "password3"}}); err != nil {
+		t.Fatalf("failed to upsert user: %s", err.Error())
+	}
+	for _, cred := range store.credentials() {
+		for _, pw := range append([]string{cred.Password}, cred.Passwords...) {
+			if pw != "" && !isBcryptHash(pw) {
+				t.Fatalf("plaintext password stored for %s", cred.Username)
+			}
+		}
+	}
+	if !store.Check("username1", "password1") || !store.Check("username2", "password3") {
+		t.Fatalf("users not authenticated after hashing")
+	}
+}
+
+func Test_AuthHashPlaintextOnLoadDisabled(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(`[{"username": "username1", "password": "password1"}]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	if pw, _ := store.Password("username1"); pw != "password1" {
+		t.Fatalf("password of username1 changed, got %s", pw)
+	}
+}
+
+func Test_AuthMaxBcryptCost(t *testing.T) {
+	// Forge a hash with a cost too high to compute in a test, by raising the
+	// cost recorded in a cheap one. It never needs to be verified.
+	hash := mustBcrypt(t, "password1")
+	costly := hash[:4] + "31" + hash[6:]
+	if cost, err := bcrypt.Cost([]byte(costly)); err != nil || cost != 31 {
+		t.Fatalf("failed to forge hash of cost 31, got %d (%v)", cost, err)
+	}
+
+	store := NewCredentialsStore()
+	if exp, got := DefaultMaxBcryptCost, store.MaxBcryptCost; exp != got {
+		t.Fatalf("wrong default max bcrypt cost, exp %d, got %d", exp, got)
+	}
+	err := store.Load(strings.NewReader(`[{"username": "username1", "password": "` + costly + `"}]`))
+	if err == nil || !strings.Contains(err.Error(), "exceeding maximum") {
+		t.Fatalf("expected error loading costly hash, got %v", err)
+	}
+	if err := store.AddUser(Credential{Username: "username1", Passwords: []string{"password1", costly}}); err == nil {
+		t.Fatalf("expected error adding user with costly hash")
+	}
+	if err := store.Load(strings.NewReader(`[{"username": "username1", "password": "` + hash + `"}, {"username": "username2", "password": "$2a$99$plaintext"}]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	store.MaxBcryptCost = 0
+	if err := store.AddUser(Credential{Username: "username3", Password: costly}); err != nil {
+		t.Fatalf("failed to add user with limit disabled: %s", err.Error())
+	}
+}
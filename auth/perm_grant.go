@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// PermSource describes how a user came to hold a perm.
+type PermSource string
+
+const (
+	// PermSourceDirect is a perm granted in the user's own credential.
+	PermSourceDirect PermSource = "direct"
+
+	// PermSourceRole is a perm granted via one of the user's roles, and not
+	// also directly.
+	PermSourceRole PermSource = "role"
+
+	// PermSourceAllUsers is a perm granted to AllUsers, and so held by every
+	// user.
+	PermSourceAllUsers PermSource = "allusers"
+
+	// PermSourceWildcard is a wildcard perm, such as "query:*" or PermAll,
+	// granted in the user's own credential, which covers other perms.
+	PermSourceWildcard PermSource = "wildcard"
+
+	// PermSourceImplied is a perm implied by another the user holds, as set
+	// by SetPermImplications.
+	PermSourceImplied PermSource = "implied"
+)
+
+// PermGrant describes a perm held by a user, as returned by DetailedPerms.
+type PermGrant struct {
+	// Perm is the perm held.
+	Perm string
+
+	// Source is how the perm is held.
+	Source PermSource
+
+	// Role is the role granting the perm, if Source is PermSourceRole.
+	Role string
+
+	// Scope is the part of Perm after its first colon, such as "insert" for
+	// "execute:insert" or "*" for "query:*", or empty if Perm is not scoped.
+	Scope string
+
+	// Expiry is when the user's credential, and so the perm, expires, or the
+	// zero time if it never does. Perms granted to AllUsers, and those they
+	// imply, have no expiry.
+	Expiry time.Time
+}
+
+// DetailedPerms returns a PermGrant for each perm username has, being those
+// returned by Perms, sorted by perm. A perm granted both directly and via a
+// role is reported as direct, and one granted both to username and to
+// AllUsers as granted to username. As roles are expanded into perms when
+// credentials are loaded, a perm's role is the one which granted it then. The
+// grants are taken at a single point in time, and are not affected by later
+// changes to the store.
+func (c *CredentialsStore) DetailedPerms(username string) []PermGrant {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	username = c.normalize(username)
+	expiry := c.expires[username]
+
+	grants := make(map[string]PermGrant)
+	add := func(perm string, source PermSource, role string, expiry time.Time) {
+		if _, ok := grants[perm]; ok {
+			return
+		}
+		_, scope, _ := strings.Cut(perm, ":")
+		grants[perm] = PermGrant{Perm: perm, Source: source, Role: role, Scope: scope, Expiry: expiry}
+	}
+	if username != AllUsers {
+		for p := range c.perms[username] {
+			if role, ok := c.rolePerms[username][p]; ok {
+				add(p, PermSourceRole, role, expiry)
+			} else if p == PermAll || strings.HasSuffix(p, ":*") {
+				add(p, PermSourceWildcard, "", expiry)
+			} else {
+				add(p, PermSourceDirect, "", expiry)
+			}
+		}
+	}
+	for p := range c.perms[AllUsers] {
+		add(p, PermSourceAllUsers, "", time.Time{})
+	}
+	if len(c.implies) > 0 {
+		held := make([]PermGrant, 0, len(grants))
+		for _, g := range grants {
+			held = append(held, g)
+		}
+		// Visit grants to the user before those to AllUsers, so a perm
+		// implied by both carries the user's expiry.
+		sort.Slice(held, func(i, j int) bool {
+			return held[i].Source != PermSourceAllUsers && held[j].Source == PermSourceAllUsers
+		})
+		for _, g := range held {
+			for _, p := range impliedPerms(c.implies, g.Perm) {
+				add(p, PermSourceImplied, "", g.Expiry)
+			}
+		}
+	}
+
+	// As for effectivePerms, a denied perm still implies others.
+	out := make([]PermGrant, 0, len(grants))
+	for _, g := range grants {
+		if !c.isDenied(username, g.Perm) {
+			out = append(out, g)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Perm < out[j].Perm
+	})
+	return out
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_DetailedPerms(t *testing.T) {
+	const rolesStream = `[{"name": "reader", "perms": ["query", "status", "backup"]}]`
+	const jsonStream = `
+		[
+			{"username": "alice", "password": "password1", "perms": ["backup", "execute:*", "query:select"], "roles": ["reader"], "expires": "2030-01-01T00:00:00Z"},
+			{"username": "bob", "password": "password2", "perms": ["all"], "deny": ["ready"]},
+			{"username": "*", "perms": ["ready", "query:select"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.LoadRoles(strings.NewReader(rolesStream)); err != nil {
+		t.Fatalf("failed to load roles: %s", err.Error())
+	}
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	expiry := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	exp := []PermGrant{
+		{Perm: PermBackup, Source: PermSourceDirect, Expiry: expiry},
+		{Perm: "execute:*", Source: PermSourceWildcard, Scope: "*", Expiry: expiry},
+		{Perm: PermQuery, Source: PermSourceRole, Role: "reader", Expiry: expiry},
+		{Perm: "query:select", Source: PermSourceDirect, Scope: "select", Expiry: expiry},
+		{Perm: PermReady, Source: PermSourceAllUsers},
+		{Perm: PermStatus, Source: PermSourceRole, Role: "reader", Expiry: expiry},
+	}
+	if got := store.DetailedPerms("alice"); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong grants for alice, exp %+v, got %+v", exp, got)
+	}
+
+	// Denied perms are not held, even via AllUsers.
+	exp = []PermGrant{
+		{Perm: PermAll, Source: PermSourceWildcard},
+		{Perm: "query:select", Source: PermSourceAllUsers, Scope: "select"},
+	}
+	if got := store.DetailedPerms("bob"); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong grants for bob, exp %+v, got %+v", exp, got)
+	}
+
+	// Implied perms carry the expiry of the perm implying them, unless it was
+	// granted to AllUsers.
+	store.SetPermImplications(map[string][]string{
+		PermBackup: {PermLoad},
+		PermReady:  {"ping"},
+	})
+	exp = []PermGrant{
+		{Perm: PermBackup, Source: PermSourceDirect, Expiry: expiry},
+		{Perm: "execute:*", Source: PermSourceWildcard, Scope: "*", Expiry: expiry},
+		{Perm: PermLoad, Source: PermSourceImplied, Expiry: expiry},
+		{Perm: "ping", Source: PermSourceImplied},
+		{Perm: PermQuery, Source: PermSourceRole, Role: "reader", Expiry: expiry},
+		{Perm: "query:select", Source: PermSourceDirect, Scope: "select", Expiry: expiry},
+		{Perm: PermReady, Source: PermSourceAllUsers},
+		{Perm: PermStatus, Source: PermSourceRole, Role: "reader", Expiry: expiry},
+	}
+	got := store.DetailedPerms("alice")
+	if !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong grants for alice with implications, exp %+v, got %+v", exp, got)
+	}
+	var perms []string
+	for _, g := range got {
+		perms = append(perms, g.Perm)
+	}
+	if exp := store.Perms("alice"); !reflect.DeepEqual(exp, perms) {
+		t.Fatalf("grants do not match perms, exp %v, got %v", exp, perms)
+	}
+
+	// Grants are a snapshot.
+	store.RemoveUser("alice")
+	if len(got) != 8 || got[0].Perm != PermBackup {
+		t.Fatalf("grants changed by later change to store: %+v", got)
+	}
+	exp = []PermGrant{
+		{Perm: "ping", Source: PermSourceImplied},
+		{Perm: "query:select", Source: PermSourceAllUsers, Scope: "select"},
+		{Perm: PermReady, Source: PermSourceAllUsers},
+	}
+	if got := store.DetailedPerms("alice"); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong grants for removed user, exp %+v, got %+v", exp, got)
+	}
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	// DefaultReadPerms are the perms which allow a user to read, as reported by
+	// CanRead, unless overridden via CredentialsStore.ReadPerms.
+	DefaultReadPerms = []string{PermQuery, PermStatus, PermReady, PermBackup}
+
+	// DefaultWritePerms are the perms which allow a user to write, as reported
+	// by CanWrite, unless overridden via CredentialsStore.WritePerms.
+	DefaultWritePerms = []string{PermExecute, PermLoad, PermRemove}
+)
+
+// KnownPerms are the perms accepted when CredentialsStore.StrictPerms is set.
+// Deployments which use perms of their own may append to it before loading
+// any credentials.
+var KnownPerms = append([]string{PermAll}, builtinPerms...)
+
+// checkPerms returns an error if cred grants or denies any perm not in
+// KnownPerms.
+func checkPerms(cred Credential) error {
+	for _, perms := range [][]string{cred.Perms, cred.Deny} {
+		perms, _ = normalizePerms(perms)
+		for _, p := range perms {
+			if !slices.Contains(KnownPerms, p) {
+				return fmt.Errorf("unknown perm %q for user %q", p, cred.Username)
+			}
+		}
+	}
+	return nil
+}
+
+// checkRolePerms returns an error if role grants any perm not in KnownPerms.
+func checkRolePerms(role Role) error {
+	perms, _ := normalizePerms(role.Perms)
+	for _, p := range perms {
+		if !slices.Contains(KnownPerms, p) {
+			return fmt.Errorf("unknown perm %q for role %q", p, role.Name)
+		}
+	}
+	return nil
+}
+
+// normalizePerms returns perms with surrounding whitespace trimmed from each,
+// sorted, and with duplicates and empty perms removed. It also returns the
+// number of perms dropped for being empty once trimmed.
+func normalizePerms(perms []string) ([]string, int) {
+	if len(perms) == 0 {
+		return perms, 0
+	}
+	out := make([]string, 0, len(perms))
+	dropped := 0
+	for _, p := range perms {
+		if p = strings.TrimSpace(p); p == "" {
+			dropped++
+			continue
+		}
+		out = append(out, p)
+	}
+	slices.Sort(out)
+	return slices.Compact(out), dropped
+}
+
+// DefaultPermImplications is the recommended set of perm implications to pass
+// to CredentialsStore.SetPermImplications. With it, a user who may write via
+// PermExecute may also read back via PermQuery, and a user who may take
+// backups may also check node status. It is not enabled by default.
+var DefaultPermImplications = map[string][]string{
+	PermExecute: {PermQuery},
+	PermBackup:  {PermStatus},
+}
+
+var (
+	destructiveMu    sync.RWMutex
+	destructivePerms = map[string]bool{
+		PermRemove:  true,
+		PermLoad:    true,
+		PermExecute: true,
+	}
+)
+
+// IsDestructivePerm returns true if perm grants actions which can destroy data
+// or change cluster membership, and so warrants a confirmation prompt before
+// use. PermRemove, PermLoad, and PermExecute are destructive, as are any perms
+// marked via MarkDestructive.
+func IsDestructivePerm(perm string) bool {
+	destructiveMu.RLock()
+	defer destructiveMu.RUnlock()
+	return destructivePerms[perm]
+}
+
+// MarkDestructive marks perm as destructive, so that IsDestructivePerm returns
+// true for it.
+func MarkDestructive(perm string) {
+	destructiveMu.Lock()
+	defer destructiveMu.Unlock()
+	destructivePerms[perm] = true
+}
+
+// CanRead returns true if username has any perm which allows reading, either
+// directly or via AllUsers. It does not perform any password checking.
+func (c *CredentialsStore) CanRead(username string) bool {
+	c.mu.RLock()
+	perms := c.ReadPerms
+	c.mu.RUnlock()
+	if perms == nil {
+		perms = DefaultReadPerms
+	}
+	return c.authorizedAny(username, perms)
+}
+
+// CanWrite returns true if username has any perm which allows writing, either
+// directly or via AllUsers. It does not perform any password checking.
+func (c *CredentialsStore) CanWrite(username string) bool {
+	c.mu.RLock()
+	perms := c.WritePerms
+	c.mu.RUnlock()
+	if perms == nil {
+		perms = DefaultWritePerms
+	}
+	return c.authorizedAny(username, perms)
+}
+
+// authorizedAny returns true if username is authorized, as by authorized, for
+// any of perms.
+func (c *CredentialsStore) authorizedAny(username string, perms []string) bool {
+	for _, p := range perms {
+		if c.authorized(username, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,404 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_IsDestructivePerm(t *testing.T) {
+	for _, p := range []string{PermRemove, PermLoad, PermExecute} {
+		if !IsDestructivePerm(p) {
+			t.Fatalf("%s not classified as destructive", p)
+		}
+	}
+	for _, p := range []string{PermQuery, PermStatus, PermReady, PermBackup, PermJoin, "custom-drop"} {
+		if IsDestructivePerm(p) {
+			t.Fatalf("%s classified as destructive", p)
+		}
+	}
+
+	MarkDestructive("custom-drop")
+	if !IsDestructivePerm("custom-drop") {
+		t.Fatalf("custom-drop not classified as destructive after marking")
+	}
+}
+
+func Test_CanReadWrite(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "reader", "password": "password1", "perms": ["query"]},
+			{"username": "writer", "password": "password2", "perms": ["execute"]},
+			{"username": "admin", "password": "password3", "perms": ["all"]},
+			{"username": "none", "password": "password4", "perms": ["join"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	for _, tt := range []struct {
+		username string
+		read     bool
+		write    bool
+	}{
+		{"reader", true, false},
+		{"writer", false, true},
+		{"admin", true, true},
+		{"none", false, false},
+		{"nonexistent", false, false},
+	} {
+		if got := store.CanRead(tt.username); got != tt.read {
+			t.Fatalf("wrong CanRead for %s, exp %v, got %v", tt.username, tt.read, got)
+		}
+		if got := store.CanWrite(tt.username); got != tt.write {
+			t.Fatalf("wrong CanWrite for %s, exp %v, got %v", tt.username, tt.write, got)
+		}
+	}
+
+	store.ReadPerms = []string{PermJoin}
+	store.WritePerms = []string{PermQuery}
+	if !store.CanRead("none") || store.CanRead("reader") {
+		t.Fatalf("custom read mapping not honored")
+	}
+	if !store.CanWrite("reader") || store.CanWrite("writer") {
+		t.Fatalf("custom write mapping not honored")
+	}
+}
+
+func Test_PermImplications(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "writer", "password": "password1", "perms": ["execute"]},
+			{"username": "backer", "password": "password2", "perms": ["backup"]},
+			{"username": "*", "perms": ["foo"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	// Nothing is implied by default.
+	if store.HasPerm("writer", PermQuery) || store.HasPerm("backer", PermStatus) {
+		t.Fatalf("perm implied with no implications set")
+	}
+
+	store.SetPermImplications(DefaultPermImplications)
+	if !store.HasPerm("writer", PermQuery) {
+		t.Fatalf("execute does not imply query")
+	}
+	if !store.AA("writer", "password1", PermQuery) {
+		t.Fatalf("writer not authorized for query via execute")
+	}
+	if !store.HasPerm("backer", PermStatus) {
+		t.Fatalf("backup does not imply status")
+	}
+	if store.HasPerm("backer", PermQuery) || store.HasPerm("writer", PermStatus) {
+		t.Fatalf("unrelated perm implied")
+	}
+	if exp, got := []string{"execute", "foo", "query"}, store.PermsWithPrefix("writer", ""); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong effective perms for writer, exp %v, got %v", exp, got)
+	}
+
+	// Implications are transitive, and may come via AllUsers.
+	store.SetPermImplications(map[string][]string{
+		"foo":       {PermBackup},
+		PermBackup:  {PermStatus},
+		PermStatus:  {PermBackup},
+		PermExecute: {PermQuery},
+	})
+	if !store.HasPerm("writer", PermStatus) {
+		t.Fatalf("foo via * does not transitively imply status")
+	}
+
+	store.SetPermImplications(nil)
+	if store.HasPerm("writer", PermQuery) {
+		t.Fatalf("perm implied after implications cleared")
+	}
+}
+
+func Test_WildcardPerms(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "analyst", "password": "password1", "perms": ["query:*", "execute:orders"]},
+			{"username": "plain", "password": "password2", "perms": ["query"]},
+			{"username": "*", "perms": ["status:*"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	for _, tt := range []struct {
+		username string
+		perm     string
+		exp      bool
+	}{
+		{"analyst", "query:analytics", true},
+		{"analyst", "query:a:b", true},
+		{"analyst", "query", false},
+		{"analyst", "queryx", false},
+		{"analyst", "execute:orders", true},
+		{"analyst", "execute:billing", false},
+		{"analyst", "execute:*", false},
+		{"plain", PermQuery, true},
+		{"plain", "query:analytics", false},
+		{"plain", "status:analytics", true},
+		{AllUsers, "status:analytics", true},
+		{AllUsers, PermStatus, false},
+	} {
+		if got := store.HasPerm(tt.username, tt.perm); got != tt.exp {
+			t.Fatalf("HasPerm(%q, %q) = %v, exp %v", tt.username, tt.perm, got, tt.exp)
+		}
+	}
+
+	if !store.AA("", "", "status:analytics") {
+		t.Fatalf("anonymous not authorized via wildcard granted to *")
+	}
+	if !store.AA("analyst", "password1", "query:analytics") {
+		t.Fatalf("analyst not authorized via wildcard")
+	}
+	if store.AA("analyst", "password1", "execute:billing") {
+		t.Fatalf("analyst authorized for execute:billing")
+	}
+}
+
+func Test_WildcardPermsWithDeny(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(`[
+		{"username": "analyst", "password": "password1", "perms": ["query:*"], "deny": ["query:pii"]}
+	]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	for _, tt := range []struct {
+		perm string
+		exp  bool
+	}{
+		{"query:foo", true},
+		{"query:pii", false},
+		// A deny without a wildcard excludes only that perm.
+		{"query:pii:names", true},
+	} {
+		if got := store.HasPerm("analyst", tt.perm); got != tt.exp {
+			t.Fatalf("HasPerm(analyst, %q) = %v, exp %v", tt.perm, got, tt.exp)
+		}
+		if got := store.AA("analyst", "password1", tt.perm); got != tt.exp {
+			t.Fatalf("AA(analyst, %q) = %v, exp %v", tt.perm, got, tt.exp)
+		}
+	}
+}
+
+func Test_StrictPerms(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "alice", "password": "password1", "perms": ["query", "execute"]},
+			{"username": "bob", "password": "password2", "perms": ["qeury"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials without StrictPerms: %s", err.Error())
+	}
+
+	store = NewCredentialsStore()
+	store.StrictPerms = true
+	err := store.Load(strings.NewReader(jsonStream))
+	if err == nil {
+		t.Fatalf("expected error loading unknown perm with StrictPerms")
+	}
+	if exp, got := `unknown perm "qeury" for user "bob" at index 1`, err.Error(); exp != got {
+		t.Fatalf("wrong error, exp %q, got %q", exp, got)
+	}
+	if _, ok := store.Password("alice"); ok {
+		t.Fatalf("alice loaded despite error")
+	}
+	if err := store.Upsert(Credential{Username: "carol", Perms: []string{"custom"}}); err == nil {
+		t.Fatalf("expected error upserting unknown perm with StrictPerms")
+	}
+	if err := store.Upsert(Credential{Username: "carol", Perms: []string{PermAll, PermJoinReadOnly}}); err != nil {
+		t.Fatalf("failed to upsert known perms: %s", err.Error())
+	}
+}
+
+func Test_StrictPermsExtended(t *testing.T) {
+	defer func(perms []string) { KnownPerms = perms }(KnownPerms)
+	KnownPerms = append(KnownPerms[:len(KnownPerms):len(KnownPerms)], "custom")
+
+	store := NewCredentialsStore()
+	store.StrictPerms = true
+	if err := store.Upsert(Credential{Username: "carol", Perms: []string{"custom"}}); err != nil {
+		t.Fatalf("failed to upsert extended perm: %s", err.Error())
+	}
+}
+
+func Test_DenyPerms(t *testing.T) {
+	const rolesStream = `[{"name": "operator", "perms": ["all"]}]`
+	const jsonStream = `
+		[
+			{"username": "senior", "password": "password1", "roles": ["operator"]},
+			{"username": "junior", "password": "password2", "roles": ["operator"], "deny": ["remove", "load:*"]},
+			{"username": "reader", "password": "password3", "perms": ["query", "status"], "deny": ["query"]},
+			{"username": "*", "perms": ["ready"], "deny": ["status"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.LoadRoles(strings.NewReader(rolesStream)); err != nil {
+		t.Fatalf("failed to load roles: %s", err.Error())
+	}
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	for _, tt := range []struct {
+		username string
+		password string
+		perm     string
+		exp      bool
+	}{
+		{"senior", "password1", PermRemove, true},
+		{"junior", "password2", PermRemove, false},
+		{"junior", "password2", PermExecute, true},
+		{"junior", "password2", "load:main", false},
+		{"junior", "password2", PermLoad, true},
+		{"reader", "password3", PermQuery, false},
+		{"reader", "password3", PermStatus, true},
+		{"reader", "password3", PermReady, true},
+		{"", "", PermReady, true},
+	} {
+		if got := store.AA(tt.username, tt.password, tt.perm); got != tt.exp {
+			t.Fatalf("AA(%q, %q) = %v, exp %v", tt.username, tt.perm, got, tt.exp)
+		}
+	}
+
+	if store.HasPerm("reader", PermQuery) {
+		t.Fatalf("reader has denied perm")
+	}
+	if !store.HasPerm("junior", PermAll) {
+		t.Fatalf("junior does not have all")
+	}
+	if !store.CanRead("reader") || !store.CanWrite("junior") {
+		t.Fatalf("denials affected unrelated perms")
+	}
+
+	store.ReadPerms = []string{PermQuery}
+	if store.CanRead("reader") {
+		t.Fatalf("reader can read via denied perm")
+	}
+}
+
+func Test_AuthNormalizePerms(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"perms": ["status", " query", "query ", "", "  "],
+				"deny": ["remove", "remove"]
+			}
+		]
+	`
+
+	store := NewCredentialsStore()
+	store.StrictPerms = true
+	var warnings []string
+	store.SetWarningHook(func(msg string) {
+		warnings = append(warnings, msg)
+	})
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	creds := store.credentials()
+	if exp, got := []string{"query", "status"}, creds[0].Perms; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong perms, exp %v, got %v", exp, got)
+	}
+	if exp, got := []string{"remove"}, creds[0].Deny; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong denied perms, exp %v, got %v", exp, got)
+	}
+	if !store.HasPerm("username1", "query") {
+		t.Fatalf("username1 does not have trimmed perm")
+	}
+	if exp, got := []string{`dropped 2 empty perms of user "username1"`}, warnings; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong warnings, exp %v, got %v", exp, got)
+	}
+}
+
+func Test_StrictPermsWarnPermless(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "username1", "password": "password1", "perms": ["query"]},
+			{"username": "username2", "password": "password2"},
+			{"username": "username3", "password": "password3", "deny": ["status"]},
+			{"username": "username4", "password": "password4", "tenant": "a"},
+			{"username": "*", "perms": ["status"], "tenant": "a"}
+		]
+	`
+
+	var warnings []string
+	newStore := func(strict bool) *CredentialsStore {
+		store := NewCredentialsStore()
+		store.StrictPerms = strict
+		store.SetWarningHook(func(msg string) {
+			warnings = append(warnings, msg)
+		})
+		return store
+	}
+
+	// The warnings do not fail the load.
+	store := newStore(true)
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	exp := []string{`user "username2" holds no perms`, `user "username3" holds no perms`}
+	if !reflect.DeepEqual(exp, warnings) {
+		t.Fatalf("wrong warnings, exp %v, got %v", exp, warnings)
+	}
+
+	// Perms inherited from AllUsers count.
+	warnings = nil
+	store = newStore(true)
+	if err := store.Reload(strings.NewReader(`[
+		{"username": "username2", "password": "password2"},
+		{"username": "*", "perms": ["status"]}
+	]`)); err != nil {
+		t.Fatalf("failed to reload credentials: %s", err.Error())
+	}
+	if warnings != nil {
+		t.Fatalf("unexpected warnings: %v", warnings)
+	}
+
+	// No warnings unless StrictPerms is set.
+	store = newStore(false)
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	if warnings != nil {
+		t.Fatalf("unexpected warnings without StrictPerms: %v", warnings)
+	}
+}
+
+func Test_NormalizePerms(t *testing.T) {
+	for _, tt := range []struct {
+		in      []string
+		exp     []string
+		dropped int
+	}{
+		{nil, nil, 0},
+		{[]string{"b", "a", "b"}, []string{"a", "b"}, 0},
+		{[]string{" a ", "a", ""}, []string{"a"}, 1},
+		{[]string{" "}, []string{}, 1},
+	} {
+		got, dropped := normalizePerms(tt.in)
+		if !reflect.DeepEqual(tt.exp, got) || tt.dropped != dropped {
+			t.Fatalf("wrong result for %q, exp %q/%d, got %q/%d", tt.in, tt.exp, tt.dropped, got, dropped)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import "sort"
+
+// PermSet is a set of perms. The zero value is an empty set, which may be read
+// but not added to.
+type PermSet map[string]bool
+
+// NewPermSet returns a new PermSet holding perms.
+func NewPermSet(perms ...string) PermSet {
+	s := make(PermSet, len(perms))
+	s.Add(perms...)
+	return s
+}
+
+// Has returns true if the set contains perm, or a wildcard perm covering it. A
+// perm ending in ":*" covers every perm which begins with the text before the
+// "*", so "query:*" covers "query:analytics" but not "query" itself. All other
+// perms match exactly.
+func (s PermSet) Has(perm string) bool {
+	if s[perm] {
+		return true
+	}
+	for i := 0; i < len(perm); i++ {
+		if perm[i] == ':' && s[perm[:i+1]+"*"] {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds perms to the set.
+func (s PermSet) Add(perms ...string) {
+	for _, p := range perms {
+		s[p] = true
+	}
+}
+
+// Union returns a new set of the perms in either s or other.
+func (s PermSet) Union(other PermSet) PermSet {
+	u := make(PermSet, len(s)+len(other))
+	for p := range s {
+		u[p] = true
+	}
+	for p := range other {
+		u[p] = true
+	}
+	return u
+}
+
+// Sub returns a new set of the perms in s but not in other. Perms are compared
+// exactly, so a wildcard perm in other removes only that same wildcard.
+func (s PermSet) Sub(other PermSet) PermSet {
+	d := make(PermSet, len(s))
+	for p := range s {
+		if !other[p] {
+			d[p] = true
+		}
+	}
+	return d
+}
+
+// Slice returns the perms in the set, sorted, or nil if the set is empty.
+func (s PermSet) Slice() []string {
+	if len(s) == 0 {
+		return nil
+	}
+	perms := make([]string, 0, len(s))
+	for p := range s {
+		perms = append(perms, p)
+	}
+	sort.Strings(perms)
+	return perms
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_PermSetHas(t *testing.T) {
+	s := NewPermSet("status", "query:*")
+	for _, tt := range []struct {
+		perm string
+		exp  bool
+	}{
+		{"status", true},
+		{"query:analytics", true},
+		{"query:a:b", true},
+		{"query", false},
+		{"execute", false},
+	} {
+		if got := s.Has(tt.perm); got != tt.exp {
+			t.Fatalf("wrong result for %s, exp %v, got %v", tt.perm, tt.exp, got)
+		}
+	}
+
+	var empty PermSet
+	if empty.Has("status") {
+		t.Fatalf("empty set has perm")
+	}
+}
+
+func Test_PermSetOps(t *testing.T) {
+	a := NewPermSet("query", "status")
+	b := NewPermSet("status", "execute")
+
+	if exp, got := []string{"execute", "query", "status"}, a.Union(b).Slice(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong union, exp %v, got %v", exp, got)
+	}
+	if exp, got := []string{"query"}, a.Sub(b).Slice(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong difference, exp %v, got %v", exp, got)
+	}
+	if exp, got := []string{"query", "status"}, a.Slice(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("operands modified, exp %v, got %v", exp, got)
+	}
+
+	a.Add("backup", "query")
+	if exp, got := []string{"backup", "query", "status"}, a.Slice(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong set after add, exp %v, got %v", exp, got)
+	}
+	if got := NewPermSet().Slice(); got != nil {
+		t.Fatalf("expected nil slice for empty set, got %v", got)
+	}
+}
@@ -0,0 +1,32 @@
+package auth
+
+import "time"
+
+// SetRecentAuthRequirement requires that a user last explicitly authenticated
+// no more than maxAge ago to be allowed perm by AA and its variants, for perms
+// such as remove which warrant stepping up authentication. Only passing Check,
+// CheckE or CheckContext, as a login would, counts as explicit authentication.
+// The credentials carried by requests, whether for perm or any other, do not,
+// so a user who has not logged in within maxAge is denied with ErrStaleAuth
+// however often they retry. Perms granted to AllUsers need no authentication,
+// so are not affected. A maxAge which is not positive removes the
+// requirement.
+func (c *CredentialsStore) SetRecentAuthRequirement(perm string, maxAge time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if maxAge <= 0 {
+		delete(c.recentAuth, perm)
+		return
+	}
+	if c.recentAuth == nil {
+		c.recentAuth = make(map[string]time.Duration)
+	}
+	c.recentAuth[perm] = maxAge
+}
+
+// authRecent returns true if username last explicitly logged in no more than
+// maxAge ago.
+func (c *CredentialsStore) authRecent(username string, maxAge time.Duration) bool {
+	last, ok := c.lastExplicitLogin(username)
+	return ok && !c.now().After(last.Add(maxAge))
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_AuthRecentAuthRequirement(t *testing.T) {
+	store := NewCredentialsStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1", Perms: []string{PermQuery, PermRemove}}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	var events []AuditEvent
+	store.SetAuditHook(func(e AuditEvent) {
+		events = append(events, e)
+	})
+	store.SetRecentAuthRequirement(PermRemove, 5*time.Minute)
+
+	// Never explicitly authenticated, so the step-up perm is denied.
+	if store.AA("username1", "password1", PermRemove) {
+		t.Fatalf("username1 allowed remove without recent authentication")
+	}
+	if got := events[len(events)-1]; got.Allowed || got.Reason != ErrStaleAuth.Error() {
+		t.Fatalf("wrong audit event for stale authentication, got %+v", got)
+	}
+
+	// Recent authentication.
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated")
+	}
+	now = now.Add(5 * time.Minute)
+	if !store.AA("username1", "password1", PermRemove) {
+		t.Fatalf("username1 denied remove after recent authentication")
+	}
+	if store.AA("username1", "wrong", PermRemove) {
+		t.Fatalf("username1 allowed remove with wrong password")
+	}
+
+	// Stale authentication. Allowed requests did not refresh the window.
+	now = now.Add(time.Second)
+	if store.AA("username1", "password1", PermRemove) {
+		t.Fatalf("username1 allowed remove after stale authentication")
+	}
+	if ok, _ := store.AADryRun("username1", "password1", PermRemove); ok {
+		t.Fatalf("dry run allowed remove after stale authentication")
+	}
+
+	// Removing the requirement allows the perm again.
+	store.SetRecentAuthRequirement(PermRemove, 0)
+	if !store.AA("username1", "password1", PermRemove) {
+		t.Fatalf("username1 denied remove after requirement removed")
+	}
+}
+
+func Test_AuthRecentAuthRequirementRetry(t *testing.T) {
+	store := NewCredentialsStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1", Perms: []string{PermQuery, PermRemove}}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	store.SetRecentAuthRequirement(PermRemove, 5*time.Minute)
+
+	// Requests for other perms, with the correct password, do not count as
+	// recent authentication.
+	if store.AA("username1", "password1", PermRemove) {
+		t.Fatalf("username1 allowed remove without recent authentication")
+	}
+	if !store.AA("username1", "password1", PermQuery) {
+		t.Fatalf("username1 denied perm without a requirement")
+	}
+	if !store.CheckRequest(&testBasicAuther{username: "username1", password: "password1", ok: true}) {
+		t.Fatalf("username1 request not authenticated")
+	}
+	if store.AA("username1", "password1", PermRemove) {
+		t.Fatalf("username1 allowed remove after retrying via another perm")
+	}
+	if _, ok := store.LastLogin("username1"); !ok {
+		t.Fatalf("requests not recorded as logins")
+	}
+
+	if ok, _ := store.CheckE("username1", "password1"); !ok {
+		t.Fatalf("username1 not authenticated")
+	}
+	if !store.AA("username1", "password1", PermRemove) {
+		t.Fatalf("username1 denied remove after explicit authentication")
+	}
+}
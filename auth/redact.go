@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// redactedPassword replaces passwords in redacted Credentials.
+const redactedPassword = "***"
+
+// rawCredential has the fields of Credential but none of its methods, so that it
+// is formatted and marshaled with its passwords intact.
+type rawCredential Credential
+
+// Redacted returns a copy of the Credential with every non-empty password
+// replaced by "***".
+func (c Credential) Redacted() Credential {
+	if c.Password != "" {
+		c.Password = redactedPassword
+	}
+	if c.Passwords != nil {
+		pws := make([]string, len(c.Passwords))
+		for i, pw := range c.Passwords {
+			if pw != "" {
+				pws[i] = redactedPassword
+			}
+		}
+		c.Passwords = pws
+	}
+	return c
+}
+
+// String returns the Credential formatted as by the %+v verb, but with its
+// passwords redacted, so that Credentials can be logged safely.
+func (c Credential) String() string {
+	return fmt.Sprintf("%+v", rawCredential(c.Redacted()))
+}
+
+// MarshalJSON marshals the Credential with its passwords redacted, so that
+// Credentials can be logged safely. Dump, by contrast, writes passwords intact,
+// so that its output can be loaded.
+func (c Credential) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rawCredential(c.Redacted()))
+}
+
+// rawCredentials converts creds for marshaling with their passwords intact.
+func rawCredentials(creds []Credential) []rawCredential {
+	raw := make([]rawCredential, len(creds))
+	for i := range creds {
+		raw[i] = rawCredential(creds[i])
+	}
+	return raw
+}
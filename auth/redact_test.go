@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_CredentialRedacted(t *testing.T) {
+	cred := Credential{
+		Username:  "username1",
+		Password:  "password1",
+		Passwords: []string{"password2", ""},
+		Perms:     []string{"query"},
+	}
+
+	for _, s := range []string{
+		cred.String(),
+		fmt.Sprintf("%v", cred),
+		fmt.Sprintf("%+v", cred),
+		fmt.Sprintf("%s", &cred),
+	} {
+		if strings.Contains(s, "password1") || strings.Contains(s, "password2") {
+			t.Fatalf("password exposed in formatted Credential: %s", s)
+		}
+		if !strings.Contains(s, "username1") || !strings.Contains(s, "***") {
+			t.Fatalf("Credential not formatted as expected: %s", s)
+		}
+	}
+
+	b, err := json.Marshal(cred)
+	if err != nil {
+		t.Fatalf("failed to marshal Credential: %s", err.Error())
+	}
+	if exp, got := `{"username":"username1","password":"***","passwords":["***",""],"perms":["query"]}`, string(b); exp != got {
+		t.Fatalf("wrong JSON for Credential, exp %s, got %s", exp, got)
+	}
+	b, err = json.Marshal([]*Credential{&cred})
+	if err != nil {
+		t.Fatalf("failed to marshal Credential: %s", err.Error())
+	}
+	if strings.Contains(string(b), "password1") {
+		t.Fatalf("password exposed in marshaled Credential pointer: %s", b)
+	}
+
+	if cred.Password != "password1" || cred.Passwords[0] != "password2" {
+		t.Fatalf("redaction modified the Credential")
+	}
+	if r := (Credential{Username: "username1"}).Redacted(); r.Password != "" {
+		t.Fatalf("empty password redacted")
+	}
+}
+
+func Test_DumpNotRedacted(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1"}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	var buf bytes.Buffer
+	if err := store.Dump(&buf); err != nil {
+		t.Fatalf("failed to dump: %s", err.Error())
+	}
+	if !strings.Contains(buf.String(), `"password":"password1"`) {
+		t.Fatalf("password not written by Dump: %s", buf.String())
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Role is a named set of perms, which may be granted to many users at once by
+// listing the role's name in each Credential's Roles.
+type Role struct {
+	Name  string   `json:"name"`
+	Perms []string `json:"perms,omitempty"`
+}
+
+// LoadRoles loads role definitions from a reader containing a JSON array of
+// Roles, for example [{"name": "reader", "perms": ["query", "status"]}]. A role
+// with the same name as one already defined replaces it. If StrictPerms is set,
+// roles granting any perm not in KnownPerms are rejected.
+//
+// Roles are expanded into perms when a credential is loaded, so roles must be
+// loaded before the credentials which refer to them, and redefining a role does
+// not change the perms of users already loaded.
+func (c *CredentialsStore) LoadRoles(r io.Reader) error {
+	var roles []Role
+	if err := json.NewDecoder(r).Decode(&roles); err != nil {
+		return err
+	}
+	for i, role := range roles {
+		if role.Name == "" {
+			return fmt.Errorf("empty role name at index %d", i)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.StrictPerms {
+		for i, role := range roles {
+			if err := checkRolePerms(role); err != nil {
+				return fmt.Errorf("%s at index %d", err.Error(), i)
+			}
+		}
+	}
+	if c.roles == nil {
+		c.roles = make(map[string][]string, len(roles))
+	}
+	for _, role := range roles {
+		c.roles[role.Name] = append([]string(nil), role.Perms...)
+	}
+	return nil
+}
+
+// checkRoles returns an error if cred refers to a role which has not been
+// defined. The caller must hold the read lock.
+func (c *CredentialsStore) checkRoles(cred Credential) error {
+	for _, r := range cred.Roles {
+		if _, ok := c.roles[r]; !ok {
+			return fmt.Errorf("unknown role %q for user %q", r, cred.Username)
+		}
+	}
+	return nil
+}
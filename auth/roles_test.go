@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Roles(t *testing.T) {
+	const rolesStream = `
+		[
+			{"name": "reader", "perms": ["query", "status"]},
+			{"name": "writer", "perms": ["execute"]}
+		]
+	`
+	const jsonStream = `
+		[
+			{"username": "alice", "password": "password1", "roles": ["reader", "writer"]},
+			{"username": "bob", "password": "password2", "perms": ["backup"], "roles": ["reader"]},
+			{"username": "carol", "password": "password3", "perms": ["load"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.LoadRoles(strings.NewReader(rolesStream)); err != nil {
+		t.Fatalf("failed to load roles: %s", err.Error())
+	}
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	for _, tt := range []struct {
+		username string
+		perm     string
+		exp      bool
+	}{
+		{"alice", PermQuery, true},
+		{"alice", PermStatus, true},
+		{"alice", PermExecute, true},
+		{"alice", PermBackup, false},
+		{"bob", PermQuery, true},
+		{"bob", PermBackup, true},
+		{"bob", PermExecute, false},
+		{"carol", PermLoad, true},
+		{"carol", PermQuery, false},
+	} {
+		if got := store.HasPerm(tt.username, tt.perm); got != tt.exp {
+			t.Fatalf("HasPerm(%q, %q) = %v, exp %v", tt.username, tt.perm, got, tt.exp)
+		}
+	}
+}
+
+func Test_RolesUnknown(t *testing.T) {
+	store := NewCredentialsStore()
+	err := store.Load(strings.NewReader(`[
+		{"username": "alice", "password": "password1", "perms": ["query"]},
+		{"username": "bob", "password": "password2", "roles": ["admin"]}
+	]`))
+	if err == nil {
+		t.Fatalf("expected error loading credentials with unknown role")
+	}
+	if exp, got := `unknown role "admin" for user "bob" at index 1`, err.Error(); exp != got {
+		t.Fatalf("wrong error, exp %q, got %q", exp, got)
+	}
+	if _, ok := store.Password("alice"); ok {
+		t.Fatalf("alice loaded despite error")
+	}
+
+	if err := store.Upsert(Credential{Username: "carol", Roles: []string{"admin"}}); err == nil {
+		t.Fatalf("expected error upserting credential with unknown role")
+	}
+}
+
+func Test_RolesEmptyName(t *testing.T) {
+	store := NewCredentialsStore()
+	err := store.LoadRoles(strings.NewReader(`[{"name": "reader"}, {"perms": ["query"]}]`))
+	if err == nil {
+		t.Fatalf("expected error loading role with empty name")
+	}
+	if exp, got := "empty role name at index 1", err.Error(); exp != got {
+		t.Fatalf("wrong error, exp %q, got %q", exp, got)
+	}
+}
+
+func Test_RolesStrictPerms(t *testing.T) {
+	store := NewCredentialsStore()
+	store.StrictPerms = true
+	err := store.LoadRoles(strings.NewReader(`[{"name": "reader", "perms": ["query"]}, {"name": "writer", "perms": ["qeury"]}]`))
+	if err == nil {
+		t.Fatalf("expected error loading role with unknown perm")
+	}
+	if exp, got := `unknown perm "qeury" for role "writer" at index 1`, err.Error(); exp != got {
+		t.Fatalf("wrong error, exp %q, got %q", exp, got)
+	}
+	if err := store.Upsert(Credential{Username: "alice", Roles: []string{"reader"}}); err == nil {
+		t.Fatalf("role loaded despite error")
+	}
+
+	store.StrictPerms = false
+	if err := store.LoadRoles(strings.NewReader(`[{"name": "writer", "perms": ["qeury"]}]`)); err != nil {
+		t.Fatalf("failed to load role without StrictPerms: %s", err.Error())
+	}
+}
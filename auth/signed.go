@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrInvalidSignature is returned when a signed credentials file fails verification.
+var ErrInvalidSignature = errors.New("invalid credentials signature")
+
+// ErrInvalidKey is returned when a key passed to SaveSigned or
+// NewCredentialsStoreFromSignedFile is not of the size required by Ed25519.
+var ErrInvalidKey = errors.New("invalid Ed25519 key")
+
+// SaveSigned writes the credentials in the store to the file at path, in the
+// same JSON format consumed by Load, followed by an Ed25519 signature over those
+// JSON bytes. The file can be read back with NewCredentialsStoreFromSignedFile.
+// If privKey is not of size ed25519.PrivateKeySize, an error wrapping
+// ErrInvalidKey is returned.
+func (c *CredentialsStore) SaveSigned(path string, privKey ed25519.PrivateKey) error {
+	if len(privKey) != ed25519.PrivateKeySize {
+		return fmt.Errorf("%w: private key has size %d, expected %d", ErrInvalidKey, len(privKey), ed25519.PrivateKeySize)
+	}
+	b, err := json.Marshal(rawCredentials(c.credentials()))
+	if err != nil {
+		return err
+	}
+	sig := ed25519.Sign(privKey, b)
+	return os.WriteFile(path, append(b, sig...), 0600)
+}
+
+// NewCredentialsStoreFromSignedFile returns a new instance of a CredentialStore
+// loaded from a file written by SaveSigned. If the signature does not verify
+// using pubKey, ErrInvalidSignature is returned and no store is created. If
+// pubKey is not of size ed25519.PublicKeySize, an error wrapping ErrInvalidKey
+// is returned.
+func NewCredentialsStoreFromSignedFile(path string, pubKey ed25519.PublicKey) (*CredentialsStore, error) {
+	if len(pubKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: public key has size %d, expected %d", ErrInvalidKey, len(pubKey), ed25519.PublicKeySize)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < ed25519.SignatureSize {
+		return nil, ErrInvalidSignature
+	}
+	data, sig := b[:len(b)-ed25519.SignatureSize], b[len(b)-ed25519.SignatureSize:]
+	if !ed25519.Verify(pubKey, data, sig) {
+		return nil, ErrInvalidSignature
+	}
+
+	c := NewCredentialsStore()
+	if err := c.Load(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
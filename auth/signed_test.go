@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_SignedRoundTrip(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"perms": ["foo", "bar"]
+			},
+			{
+				"username": "*",
+				"perms": ["qux"]
+			}
+		]
+	`
+	pub, priv := mustGenerateKey(t)
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	path := filepath.Join(t.TempDir(), "creds.signed")
+	if err := store.SaveSigned(path, priv); err != nil {
+		t.Fatalf("failed to save signed credentials: %s", err.Error())
+	}
+
+	loaded, err := NewCredentialsStoreFromSignedFile(path, pub)
+	if err != nil {
+		t.Fatalf("failed to load signed credentials: %s", err.Error())
+	}
+	if !loaded.Check("username1", "password1") {
+		t.Fatalf("username1 credential not loaded correctly")
+	}
+	if !loaded.HasPerm("username1", "foo") || !loaded.HasPerm("username1", "bar") {
+		t.Fatalf("username1 perms not loaded correctly")
+	}
+	if !loaded.HasPerm("username1", "qux") {
+		t.Fatalf("username1 should have qux perm via *")
+	}
+}
+
+func Test_SignedTampered(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"perms": ["query"]
+			}
+		]
+	`
+	pub, priv := mustGenerateKey(t)
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	path := filepath.Join(t.TempDir(), "creds.signed")
+	if err := store.SaveSigned(path, priv); err != nil {
+		t.Fatalf("failed to save signed credentials: %s", err.Error())
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read signed file: %s", err.Error())
+	}
+	tampered := strings.Replace(string(b), `"query"`, `"all"`, 1)
+	if err := os.WriteFile(path, []byte(tampered), 0600); err != nil {
+		t.Fatalf("failed to write tampered file: %s", err.Error())
+	}
+	if _, err := NewCredentialsStoreFromSignedFile(path, pub); err != ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature for tampered file, got %v", err)
+	}
+
+	// Wrong key should also be rejected.
+	if err := store.SaveSigned(path, priv); err != nil {
+		t.Fatalf("failed to save signed credentials: %s", err.Error())
+	}
+	otherPub, _ := mustGenerateKey(t)
+	if _, err := NewCredentialsStoreFromSignedFile(path, otherPub); err != ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature for wrong key, got %v", err)
+	}
+
+	// A truncated file should be rejected.
+	if err := os.WriteFile(path, []byte("[]"), 0600); err != nil {
+		t.Fatalf("failed to write truncated file: %s", err.Error())
+	}
+	if _, err := NewCredentialsStoreFromSignedFile(path, pub); err != ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature for truncated file, got %v", err)
+	}
+}
+
+func Test_SignedInvalidKey(t *testing.T) {
+	pub, priv := mustGenerateKey(t)
+	store := NewCredentialsStore()
+	if err := store.AddUser(Credential{Username: "username1", Password: "password1"}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	path := filepath.Join(t.TempDir(), "creds.signed")
+
+	for _, key := range []ed25519.PrivateKey{nil, priv[:5]} {
+		if err := store.SaveSigned(path, key); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("expected ErrInvalidKey for private key of size %d, got %v", len(key), err)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("signed file written with invalid key")
+	}
+
+	if err := store.SaveSigned(path, priv); err != nil {
+		t.Fatalf("failed to save signed credentials: %s", err.Error())
+	}
+	for _, key := range []ed25519.PublicKey{nil, pub[:5]} {
+		if _, err := NewCredentialsStoreFromSignedFile(path, key); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("expected ErrInvalidKey for public key of size %d, got %v", len(key), err)
+		}
+	}
+}
+
+func mustGenerateKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err.Error())
+	}
+	return pub, priv
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Source is a source of credentials, such as a file, a secrets manager, or a
+// database.
+type Source interface {
+	// Fetch returns the current credentials.
+	Fetch(ctx context.Context) ([]Credential, error)
+}
+
+// FileSource is a Source which reads credentials from a file, as JSON, or as
+// YAML if the file has a .yaml or .yml extension.
+type FileSource struct {
+	Path string
+}
+
+// Fetch reads the credentials from the file.
+func (f *FileSource) Fetch(ctx context.Context) ([]Credential, error) {
+	r, err := os.Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if isYAMLFile(f.Path) {
+		return decodeYAMLCredentials(r)
+	}
+	return decodeCredentials(r)
+}
+
+// SetSourceErrorCallback sets a function which is called with the error each
+// time a periodic fetch started by WatchSource fails. Passing nil removes the
+// callback.
+func (c *CredentialsStore) SetSourceErrorCallback(fn func(err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sourceErrorCallback = fn
+}
+
+// RefreshFromSource fetches credentials from src and replaces every credential
+// in the store with them, as by ReplaceAll. If the fetch fails, or the
+// credentials are invalid, an error is returned and the store is left
+// unchanged.
+func (c *CredentialsStore) RefreshFromSource(ctx context.Context, src Source) error {
+	creds, err := src.Fetch(ctx)
+	if err != nil {
+		return err
+	}
+	return c.ReplaceAll(creds)
+}
+
+// WatchSource refreshes the store from src, as by RefreshFromSource, and then
+// again every interval in the background until ctx is done. An error is
+// returned only if interval is not positive, in which case the store is not
+// refreshed at all, or if the first refresh fails. If a later refresh fails,
+// the store keeps its previous credentials, and the error is passed to the
+// callback set by SetSourceErrorCallback.
+func (c *CredentialsStore) WatchSource(ctx context.Context, src Source, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("non-positive source refresh interval %s", interval)
+	}
+	if err := c.RefreshFromSource(ctx, src); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := c.RefreshFromSource(ctx, src)
+				if err == nil || ctx.Err() != nil {
+					continue
+				}
+				c.mu.RLock()
+				fn := c.sourceErrorCallback
+				c.mu.RUnlock()
+				if fn != nil {
+					fn(err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// NewCredentialsStoreFromSource returns a new instance of a CredentialStore
+// backed by src, refreshed every interval until ctx is done, as by WatchSource.
+func NewCredentialsStoreFromSource(ctx context.Context, src Source, interval time.Duration) (*CredentialsStore, error) {
+	c := NewCredentialsStore()
+	if err := c.WatchSource(ctx, src, interval); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSource is a Source returning whatever credentials or error it was last
+// given.
+type testSource struct {
+	mu    sync.Mutex
+	creds []Credential
+	err   error
+}
+
+func (s *testSource) set(creds []Credential, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.creds, s.err = creds, err
+}
+
+func (s *testSource) Fetch(ctx context.Context) ([]Credential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.creds, s.err
+}
+
+func Test_AuthWatchSource(t *testing.T) {
+	src := &testSource{}
+	src.set([]Credential{{Username: "username1", Password: "password1"}}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store, err := NewCredentialsStoreFromSource(ctx, src, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to create store from source: %s", err.Error())
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated")
+	}
+	errCh := make(chan error, 1)
+	store.SetSourceErrorCallback(func(err error) {
+		select {
+		case errCh <- err:
+		default:
+		}
+	})
+
+	// A failed fetch must leave the store unchanged, and be reported.
+	fetchErr := errors.New("source unavailable")
+	src.set(nil, fetchErr)
+	select {
+	case err := <-errCh:
+		if err != fetchErr {
+			t.Fatalf("wrong error reported, exp %v, got %v", fetchErr, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("fetch error not reported")
+	}
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 removed by failed fetch")
+	}
+
+	src.set([]Credential{{Username: "username2", Password: "password2"}}, nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for !store.Check("username2", "password2") {
+		if time.Now().After(deadline) {
+			t.Fatalf("store not refreshed from source")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if store.Check("username1", "password1") {
+		t.Fatalf("username1 not removed by refresh")
+	}
+}
+
+func Test_AuthWatchSourceFirstFetchFails(t *testing.T) {
+	src := &testSource{}
+	src.set(nil, errors.New("source unavailable"))
+	if _, err := NewCredentialsStoreFromSource(context.Background(), src, time.Minute); err == nil {
+		t.Fatalf("expected error when first fetch fails")
+	}
+}
+
+func Test_AuthWatchSourceBadInterval(t *testing.T) {
+	src := &testSource{}
+	src.set([]Credential{{Username: "username1", Password: "password1"}}, nil)
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := NewCredentialsStoreFromSource(context.Background(), src, interval); err == nil {
+			t.Fatalf("expected error creating store with interval %s", interval)
+		}
+		store := NewCredentialsStore()
+		if err := store.WatchSource(context.Background(), src, interval); err == nil {
+			t.Fatalf("expected error watching source with interval %s", interval)
+		}
+		if len(store.Users()) != 0 {
+			t.Fatalf("store refreshed despite interval %s", interval)
+		}
+	}
+}
+
+func Test_FileSource(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "auth.json")
+	mustWriteFile(t, jsonPath, `[{"username": "username1", "password": "password1"}]`)
+	yamlPath := filepath.Join(dir, "auth.yaml")
+	mustWriteFile(t, yamlPath, "- username: username2\n  password: password2\n")
+
+	for path, exp := range map[string]string{jsonPath: "username1", yamlPath: "username2"} {
+		creds, err := (&FileSource{Path: path}).Fetch(context.Background())
+		if err != nil {
+			t.Fatalf("failed to fetch from %s: %s", path, err.Error())
+		}
+		if len(creds) != 1 || creds[0].Username != exp {
+			t.Fatalf("wrong credentials from %s, got %v", path, creds)
+		}
+	}
+
+	if _, err := (&FileSource{Path: filepath.Join(dir, "missing.json")}).Fetch(context.Background()); err == nil {
+		t.Fatalf("expected error fetching from missing file")
+	}
+}
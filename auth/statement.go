@@ -0,0 +1,63 @@
+package auth
+
+import "strings"
+
+// Kinds of SQL statement, as passed to CheckStatementPerm.
+const (
+	StatementSelect = "select"
+	StatementPragma = "pragma"
+	StatementInsert = "insert"
+	StatementUpdate = "update"
+	StatementDelete = "delete"
+	StatementCreate = "create"
+	StatementDrop   = "drop"
+	StatementAlter  = "alter"
+)
+
+// DefaultStatementPerms maps each kind of SQL statement to the perm which allows
+// it, unless overridden via CredentialsStore.StatementPerms. Each perm is scoped
+// under PermQuery or PermExecute, so that for example "execute:*" allows every
+// statement which writes.
+var DefaultStatementPerms = map[string]string{
+	StatementSelect: PermQuery + ":" + StatementSelect,
+	StatementPragma: PermExecute + ":" + StatementPragma,
+	StatementInsert: PermExecute + ":" + StatementInsert,
+	StatementUpdate: PermExecute + ":" + StatementUpdate,
+	StatementDelete: PermExecute + ":" + StatementDelete,
+	StatementCreate: PermExecute + ":" + StatementCreate,
+	StatementDrop:   PermExecute + ":" + StatementDrop,
+	StatementAlter:  PermExecute + ":" + StatementAlter,
+}
+
+// CheckStatementPerm returns true if username may run SQL statements of the
+// given kind, such as StatementInsert. Kinds are matched regardless of case.
+// The kind is mapped to a perm, such as "execute:insert", which username may
+// hold directly or via a wildcard. Failing that, username may hold the perm's
+// base, such as PermExecute, provided the scoped perm is not denied, so that
+// for example a user granted PermExecute but denied "execute:drop" may insert
+// but not drop. A kind with no mapped perm requires PermExecute. It does not
+// perform any password checking.
+func (c *CredentialsStore) CheckStatementPerm(username, sqlKind string) bool {
+	c.mu.RLock()
+	mapping := c.StatementPerms
+	c.mu.RUnlock()
+	if mapping == nil {
+		mapping = DefaultStatementPerms
+	}
+
+	perm, ok := mapping[strings.ToLower(strings.TrimSpace(sqlKind))]
+	if !ok {
+		return c.authorized(username, PermExecute)
+	}
+	if c.authorized(username, perm) {
+		return true
+	}
+	base, _, found := strings.Cut(perm, ":")
+	if !found {
+		return false
+	}
+	c.mu.RLock()
+	denied := c.isDenied(username, perm)
+	c.mu.RUnlock()
+	return !denied && c.authorized(username, base)
+}
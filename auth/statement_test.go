@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_AuthCheckStatementPerm(t *testing.T) {
+	const jsonStream = `
+		[
+			{
+				"username": "reader",
+				"password": "password1",
+				"perms": ["query"],
+				"deny": ["query:select"]
+			},
+			{
+				"username": "writer",
+				"password": "password2",
+				"perms": ["execute", "query:select"],
+				"deny": ["execute:drop", "execute:pragma"]
+			},
+			{
+				"username": "inserter",
+				"password": "password3",
+				"perms": ["execute:insert"]
+			},
+			{
+				"username": "admin",
+				"password": "password4",
+				"perms": ["all"]
+			},
+			{
+				"username": "scoped",
+				"password": "password5",
+				"perms": ["execute:*"]
+			}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	for _, tt := range []struct {
+		username string
+		kind     string
+		exp      bool
+	}{
+		{"reader", StatementSelect, false},
+		{"reader", StatementInsert, false},
+		{"writer", StatementSelect, true},
+		{"writer", "INSERT", true},
+		{"writer", StatementDrop, false},
+		{"writer", StatementPragma, false},
+		{"writer", "vacuum", true},
+		{"inserter", StatementInsert, true},
+		{"inserter", StatementUpdate, false},
+		{"inserter", StatementSelect, false},
+		{"inserter", "vacuum", false},
+		{"admin", StatementDrop, true},
+		{"scoped", StatementDrop, true},
+		{"scoped", StatementSelect, false},
+		{"nobody", StatementSelect, false},
+	} {
+		if got := store.CheckStatementPerm(tt.username, tt.kind); got != tt.exp {
+			t.Fatalf("wrong result for %s/%s, exp %v, got %v", tt.username, tt.kind, tt.exp, got)
+		}
+	}
+
+	store.StatementPerms = map[string]string{StatementSelect: "reporting"}
+	if store.CheckStatementPerm("writer", StatementSelect) {
+		t.Fatalf("custom statement perms not used")
+	}
+}
@@ -0,0 +1,44 @@
+package auth
+
+import "sync/atomic"
+
+// Stats contains counts of the authentication work performed by a
+// CredentialsStore, since it was created.
+type Stats struct {
+	// Checks is the number of times a username and password was checked,
+	// including via CheckRequest and AA.
+	Checks int64
+
+	// CacheHits and CacheMisses count lookups of the hash cache made while
+	// verifying hashed passwords.
+	CacheHits   int64
+	CacheMisses int64
+
+	// NegativeCacheHits is the number of times a wrong password was rejected
+	// from the negative hash cache, without a hash computation.
+	NegativeCacheHits int64
+
+	// HashComputations is the number of times a hashed password was verified
+	// by computing its hash, such as via bcrypt. A rise in this rate relative
+	// to Checks suggests the hash cache is being bypassed.
+	HashComputations int64
+
+	// UnknownUser, BadPassword and LockedOut count failed checks, by reason.
+	UnknownUser int64
+	BadPassword int64
+	LockedOut   int64
+}
+
+// Stats returns a snapshot of the store's authentication counters.
+func (c *CredentialsStore) Stats() Stats {
+	return Stats{
+		Checks:            atomic.LoadInt64(&c.stats.Checks),
+		CacheHits:         atomic.LoadInt64(&c.stats.CacheHits),
+		CacheMisses:       atomic.LoadInt64(&c.stats.CacheMisses),
+		HashComputations:  atomic.LoadInt64(&c.stats.HashComputations),
+		NegativeCacheHits: atomic.LoadInt64(&c.stats.NegativeCacheHits),
+		UnknownUser:       atomic.LoadInt64(&c.stats.UnknownUser),
+		BadPassword:       atomic.LoadInt64(&c.stats.BadPassword),
+		LockedOut:         atomic.LoadInt64(&c.stats.LockedOut),
+	}
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Stats(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.AddUser(Credential{Username: "username1", Password: mustBcrypt(t, "password1"), Perms: []string{PermQuery}}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	if err := store.AddUser(Credential{Username: "username2", Password: "password2"}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+
+	store.Check("username1", "password1") // Miss, computed.
+	store.Check("username1", "password1") // Hit.
+	store.Check("username1", "wrong")     // Miss, computed, bad password.
+	store.Check("nobody", "password1")    // Unknown user.
+	store.AA("username2", "password2", PermQuery)
+	store.CheckRequest(&testBasicAuther{username: "username2", password: "wrong", ok: true})
+
+	store.SetLockoutPolicy(&LockoutPolicy{MaxFailures: 1, Duration: time.Hour})
+	store.Check("username2", "wrong") // Bad password, locks out.
+	store.Check("username2", "wrong") // Locked out.
+
+	exp := Stats{
+		Checks:           8,
+		CacheHits:        1,
+		CacheMisses:      2,
+		HashComputations: 2,
+		UnknownUser:      1,
+		BadPassword:      3,
+		LockedOut:        1,
+	}
+	if got := store.Stats(); got != exp {
+		t.Fatalf("wrong stats, exp %+v, got %+v", exp, got)
+	}
+}
@@ -0,0 +1,70 @@
+package auth
+
+// HasTenantPerm returns true if username belongs to tenant and has the given
+// perm, either directly or via the AllUsers grants for that tenant. A user who
+// belongs to a different tenant never has the perm, even if it is granted to
+// them directly. Users and AllUsers grants with no tenant belong to the empty
+// tenant. It does not perform any password checking.
+func (c *CredentialsStore) HasTenantPerm(tenant, username, perm string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if username != AllUsers {
+		username = c.normalize(username)
+		if c.tenants[username] != tenant || c.isDenied(username, perm) {
+			return false
+		}
+		if c.perms[username].Has(perm) {
+			return true
+		}
+	}
+
+	if tenant == "" {
+		return c.perms[AllUsers].Has(perm)
+	}
+	return c.tenantAllUsers[tenant].Has(perm)
+}
+
+// HasAnyTenantPerm returns true if username belongs to tenant and has at least
+// one of the given perms. It does not perform any password checking.
+func (c *CredentialsStore) HasAnyTenantPerm(tenant, username string, perm ...string) bool {
+	for i := range perm {
+		if c.HasTenantPerm(tenant, username, perm[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// AATenant is like AA, but only authorizes the request if the user belongs to
+// tenant, and only consults the AllUsers grants made for that tenant. Perms
+// granted to AuthedUsers are held by every authenticated user of the tenant.
+func (c *CredentialsStore) AATenant(tenant, username, password, perm string) bool {
+	allowed, _, _ := c.aa(username, password, perm, -1, checkOptions{tenanted: true, tenant: tenant})
+	return allowed
+}
+
+// inTenant returns true if username belongs to tenant.
+func (c *CredentialsStore) inTenant(tenant, username string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tenants[c.normalize(username)] == tenant
+}
+
+// allUsersAuthorized returns true if AllUsers has perm, or has PermAll, within
+// the tenant of opts if it is tenanted.
+func (c *CredentialsStore) allUsersAuthorized(perm string, opts checkOptions) bool {
+	if opts.tenanted {
+		return c.HasAnyTenantPerm(opts.tenant, AllUsers, perm, PermAll)
+	}
+	return c.HasAnyPerm(AllUsers, perm, PermAll)
+}
+
+// userAuthorized returns true if username has perm, or has PermAll, and perm
+// is not denied to username, within the tenant of opts if it is tenanted.
+func (c *CredentialsStore) userAuthorized(username, perm string, opts checkOptions) bool {
+	if opts.tenanted {
+		return c.HasAnyTenantPerm(opts.tenant, username, perm, PermAll)
+	}
+	return c.authorized(username, perm)
+}
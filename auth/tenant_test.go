@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_TenantPerms(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "alice", "password": "password1", "perms": ["query", "execute"], "tenant": "a"},
+			{"username": "bob", "password": "password2", "perms": ["query", "execute"], "tenant": "b"},
+			{"username": "carol", "password": "password3", "perms": ["query"]},
+			{"username": "*", "perms": ["status"], "tenant": "a"},
+			{"username": "*", "perms": ["ready"], "tenant": "b"},
+			{"username": "*", "perms": ["backup"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	if !store.AATenant("a", "alice", "password1", PermQuery) {
+		t.Fatalf("alice not authorized for query in tenant a")
+	}
+	if store.AATenant("b", "alice", "password1", PermQuery) {
+		t.Fatalf("alice authorized for query in tenant b")
+	}
+	if !store.AATenant("b", "bob", "password2", PermExecute) {
+		t.Fatalf("bob not authorized for execute in tenant b")
+	}
+	if store.AATenant("a", "bob", "password2", PermExecute) {
+		t.Fatalf("bob authorized for execute in tenant a")
+	}
+	if store.AATenant("a", "alice", "wrong", PermQuery) {
+		t.Fatalf("alice authorized with wrong password")
+	}
+
+	// AllUsers grants are scoped to their tenant.
+	if !store.AATenant("a", "", "", PermStatus) {
+		t.Fatalf("anonymous not authorized for status in tenant a")
+	}
+	if store.AATenant("b", "", "", PermStatus) {
+		t.Fatalf("anonymous authorized for status in tenant b")
+	}
+	if !store.HasTenantPerm("a", "alice", PermStatus) {
+		t.Fatalf("alice does not have status via * in tenant a")
+	}
+	if store.HasTenantPerm("a", "alice", PermReady) {
+		t.Fatalf("alice has ready via * of tenant b")
+	}
+	if store.HasTenantPerm("a", "alice", PermBackup) {
+		t.Fatalf("alice has backup via untenanted *")
+	}
+
+	// Users without a tenant belong to the empty tenant.
+	if !store.AATenant("", "carol", "password3", PermQuery) {
+		t.Fatalf("carol not authorized for query in empty tenant")
+	}
+	if store.AATenant("a", "carol", "password3", PermQuery) {
+		t.Fatalf("carol authorized for query in tenant a")
+	}
+	if !store.AATenant("", "", "", PermBackup) {
+		t.Fatalf("anonymous not authorized for backup in empty tenant")
+	}
+
+	// Tenant-unaware checks are unchanged.
+	if !store.HasPerm("alice", PermQuery) || !store.HasPerm("alice", PermBackup) {
+		t.Fatalf("tenant-unaware perm checks changed")
+	}
+	if store.HasPerm("alice", PermStatus) {
+		t.Fatalf("tenant * grant leaked into tenant-unaware check")
+	}
+}
+
+func Test_TenantIntrospectionMatchesHasPerm(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(`[
+		{"username": "alice", "password": "password1", "perms": ["query"], "tenant": "a"},
+		{"username": "*", "perms": ["status"]},
+		{"username": "*", "perms": ["ready"], "tenant": "a"}
+	]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	exp := []string{PermQuery, PermStatus}
+	if got := store.Perms("alice"); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong perms for alice, exp %v, got %v", exp, got)
+	}
+	if got := store.Snapshot()["alice"]; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("wrong snapshot perms for alice, exp %v, got %v", exp, got)
+	}
+	if got := store.PermsWithPrefix("alice", "st"); !reflect.DeepEqual([]string{PermStatus}, got) {
+		t.Fatalf("wrong perms with prefix for alice, got %v", got)
+	}
+	for _, p := range []string{PermQuery, PermStatus, PermReady} {
+		reported := store.PermsWithPrefix("alice", p) != nil
+		if store.HasPerm("alice", p) != reported || store.AA("alice", "password1", p) != reported {
+			t.Fatalf("HasPerm and AA disagree with Perms for alice and %s", p)
+		}
+	}
+}
+
+func Test_AATenantSharesAA(t *testing.T) {
+	store := NewCredentialsStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	if err := store.Load(strings.NewReader(`[
+		{"username": "alice", "password": "password1", "perms": ["query", "remove"], "tenant": "a"},
+		{"username": "bob", "password": "password2", "tenant": "b"},
+		{"username": "+", "perms": ["status"]}
+	]`)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+	var events []AuditEvent
+	store.SetAuditHook(func(e AuditEvent) {
+		events = append(events, e)
+	})
+
+	// Decisions are audited.
+	if !store.AATenant("a", "alice", "password1", PermQuery) {
+		t.Fatalf("alice not authorized for query in tenant a")
+	}
+	if store.AATenant("b", "alice", "password1", PermQuery) {
+		t.Fatalf("alice authorized for query in tenant b")
+	}
+	if len(events) != 2 || !events[0].Allowed || events[1].Allowed || events[1].Reason != AuditReasonNotGranted {
+		t.Fatalf("wrong audit events, got %+v", events)
+	}
+
+	// AuthedUsers grants hold within the user's own tenant only.
+	if !store.AATenant("b", "bob", "password2", PermStatus) {
+		t.Fatalf("bob not authorized for status via + in tenant b")
+	}
+	if store.AATenant("a", "bob", "password2", PermStatus) {
+		t.Fatalf("bob authorized for status via + in tenant a")
+	}
+
+	// Grace periods apply within the tenant only.
+	store.SetPermGracePeriod(PermExecute, now.Add(time.Hour))
+	if !store.AATenant("b", "bob", "password2", PermExecute) {
+		t.Fatalf("bob not allowed execute during grace period")
+	}
+	if store.AATenant("a", "bob", "password2", PermExecute) {
+		t.Fatalf("bob allowed execute in tenant a during grace period")
+	}
+
+	// Recent authentication requirements apply.
+	store.SetRecentAuthRequirement(PermRemove, time.Minute)
+	now = now.Add(time.Hour)
+	if store.AATenant("a", "alice", "password1", PermRemove) {
+		t.Fatalf("alice allowed remove after stale authentication")
+	}
+	if store.AA("alice", "password1", PermRemove) {
+		t.Fatalf("AA and AATenant disagree")
+	}
+}
@@ -0,0 +1,37 @@
+package auth
+
+import "strings"
+
+// TokenAuther adapts a bearer token to the BasicAuther interface, presenting
+// the token as the password of a designated username. This allows requests
+// carrying "Authorization: Bearer <token>" to be checked by CheckRequest and
+// HasPermRequest, by storing the token as that user's password.
+type TokenAuther struct {
+	username string
+	token    string
+	ok       bool
+}
+
+// NewTokenAuther returns a TokenAuther for username, with the token parsed from
+// header, the value of an Authorization header. If header does not hold a
+// bearer token, BasicAuth reports that no credentials are present.
+func NewTokenAuther(username, header string) *TokenAuther {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return &TokenAuther{}
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return &TokenAuther{}
+	}
+	return &TokenAuther{
+		username: username,
+		token:    token,
+		ok:       true,
+	}
+}
+
+// BasicAuth returns the designated username, and the token as the password.
+func (t *TokenAuther) BasicAuth() (string, string, bool) {
+	return t.username, t.token, t.ok
+}
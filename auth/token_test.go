@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_TokenAuther(t *testing.T) {
+	for _, tt := range []struct {
+		header   string
+		username string
+		token    string
+		ok       bool
+	}{
+		{"Bearer abc123", "svc", "abc123", true},
+		{"bearer abc123", "svc", "abc123", true},
+		{"Bearer   abc123 ", "svc", "abc123", true},
+		{"Bearer", "", "", false},
+		{"Bearer ", "", "", false},
+		{"Basic dXNlcjpwYXNz", "", "", false},
+		{"", "", "", false},
+	} {
+		username, token, ok := NewTokenAuther("svc", tt.header).BasicAuth()
+		if username != tt.username || token != tt.token || ok != tt.ok {
+			t.Fatalf("wrong result for header %q, exp (%q, %q, %v), got (%q, %q, %v)",
+				tt.header, tt.username, tt.token, tt.ok, username, token, ok)
+		}
+	}
+}
+
+func Test_TokenAutherCheckRequest(t *testing.T) {
+	const jsonStream = `
+		[
+			{"username": "svc", "password": "abc123", "perms": ["query"]}
+		]
+	`
+
+	store := NewCredentialsStore()
+	if err := store.Load(strings.NewReader(jsonStream)); err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	if !store.CheckRequest(NewTokenAuther("svc", "Bearer abc123")) {
+		t.Fatalf("valid token not accepted")
+	}
+	if store.CheckRequest(NewTokenAuther("svc", "Bearer wrong")) {
+		t.Fatalf("invalid token accepted")
+	}
+	if !store.HasPermRequest(NewTokenAuther("svc", "Bearer abc123"), PermQuery) {
+		t.Fatalf("token user does not have query perm")
+	}
+	if store.HasPermRequest(NewTokenAuther("svc", "Basic abc123"), PermQuery) {
+		t.Fatalf("non-bearer header granted perm")
+	}
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"fmt"
+	"io"
+)
+
+// Validate reads a JSON array of credentials from r, as accepted by Load, and
+// returns every problem found with it, or nil if there are none. Unlike Load,
+// it does not stop at the first problem, and it is stricter: perms not in
+// KnownPerms, empty passwords, malformed bcrypt and Argon2id hashes, and
+// bcrypt hashes costlier than DefaultMaxBcryptCost are all reported. Roles are
+// not checked, as they are loaded separately. No store is modified, so
+// Validate can be used to check a credentials file before it is deployed.
+func Validate(r io.Reader) []error {
+	creds, err := decodeCredentials(r)
+	if err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	report := func(i int, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s at index %d", err.Error(), i))
+		}
+	}
+	type key struct{ username, tenant string }
+	seen := make(map[key]int, len(creds))
+	for i, cred := range creds {
+		if err := validateCredential(cred); err != nil {
+			report(i, err)
+			continue
+		}
+		k := key{cred.Username, cred.Tenant}
+		if cred.Username != AllUsers {
+			k.tenant = ""
+		}
+		if j, ok := seen[k]; ok {
+			errs = append(errs, fmt.Errorf("duplicate username %q at index %d, first at index %d", cred.Username, i, j))
+		} else {
+			seen[k] = i
+		}
+
+		report(i, checkUsername(cred.Username))
+		if _, err := parseExpires(cred.Expires); err != nil {
+			report(i, fmt.Errorf("invalid expiry for user %q: %w", cred.Username, err))
+		}
+		report(i, checkPerms(cred))
+		if cred.Username != AllUsers && cred.Username != AuthedUsers {
+			report(i, checkPasswords(cred))
+		}
+		report(i, checkBcryptCost(cred, DefaultMaxBcryptCost))
+	}
+	return errs
+}
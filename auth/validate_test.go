@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Validate(t *testing.T) {
+	hash := mustBcrypt(t, "password1")
+	costly := hash[:4] + "31" + hash[6:]
+	doc := `
+		[
+			{
+				"username": "username1",
+				"password": "password1",
+				"perms": ["query"]
+			},
+			{
+				"username": "username1",
+				"password": "password2"
+			},
+			{
+				"username": "username2",
+				"perms": ["nosuchperm"]
+			},
+			{
+				"username": "username3",
+				"password": "$2a$10$truncated"
+			},
+			{
+				"username": "username4",
+				"password": "` + costly + `",
+				"expires": "tomorrow"
+			},
+			{
+				"password": "password5"
+			},
+			{
+				"username": "*",
+				"perms": ["status"]
+			},
+			{
+				"username": "username6",
+				"password": "$argon2id$v=19$m=65536,t=0,p=4$c2FsdA$aGFzaA"
+			}
+		]
+	`
+
+	errs := Validate(strings.NewReader(doc))
+	for _, want := range []string{
+		`duplicate username "username1" at index 1, first at index 0`,
+		`unknown perm "nosuchperm" for user "username2" at index 2`,
+		`empty password for user "username2" at index 2`,
+		`invalid bcrypt hash for user "username3"`,
+		`invalid expiry for user "username4"`,
+		`exceeding maximum of 15 at index 4`,
+		`empty username at index 5`,
+		`invalid argon2id hash for user "username6"`,
+	} {
+		found := false
+		for _, err := range errs {
+			if strings.Contains(err.Error(), want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("problem %q not reported, got %v", want, errs)
+		}
+	}
+	if exp, got := 8, len(errs); exp != got {
+		t.Fatalf("wrong number of problems, exp %d, got %d: %v", exp, got, errs)
+	}
+}
+
+func Test_ValidateGood(t *testing.T) {
+	doc := `[{"username": "username1", "password": "password1", "perms": ["query"]}, {"username": "*", "perms": ["status"]}]`
+	if errs := Validate(strings.NewReader(doc)); errs != nil {
+		t.Fatalf("expected no problems, got %v", errs)
+	}
+}
+
+func Test_ValidateBadUsername(t *testing.T) {
+	doc := `[{"username": "user:name", "password": "password1"}, {"username": "username2 ", "password": "password2"}]`
+	errs := Validate(strings.NewReader(doc))
+	if exp, got := 2, len(errs); exp != got {
+		t.Fatalf("wrong number of problems, exp %d, got %d: %v", exp, got, errs)
+	}
+	if !strings.Contains(errs[0].Error(), "contains a colon") {
+		t.Fatalf("wrong problem for colon, got %v", errs[0])
+	}
+	if !strings.Contains(errs[1].Error(), "leading or trailing whitespace") {
+		t.Fatalf("wrong problem for whitespace, got %v", errs[1])
+	}
+}
+
+func Test_ValidateBadJSON(t *testing.T) {
+	errs := Validate(strings.NewReader(`{}`))
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "not a JSON array") {
+		t.Fatalf("expected single error for non-array document, got %v", errs)
+	}
+}
@@ -0,0 +1,42 @@
+package auth
+
+// Verifier verifies passwords against their stored form, allowing a
+// CredentialsStore to support password schemes of its user's choosing.
+type Verifier interface {
+	// Verify returns true if given is the password stored as stored.
+	Verify(stored, given string) bool
+}
+
+// DefaultVerifier verifies passwords as a CredentialsStore does when no
+// Verifier is set: bcrypt and Argon2id hashes are detected by their prefix, and
+// anything else is treated as a plaintext password. Custom Verifiers may fall
+// back to it for passwords not in their own scheme.
+var DefaultVerifier Verifier = defaultVerifier{}
+
+type defaultVerifier struct{}
+
+func (defaultVerifier) Verify(stored, given string) bool {
+	return verifyPassword(stored, given)
+}
+
+// SetVerifier sets the Verifier used to check passwords. With a Verifier set,
+// every non-empty stored password is checked by it, and successful
+// verifications are cached as for hashed passwords. Passing nil restores the
+// default verification. Any verifications already cached are discarded, as
+// they were made by the previous Verifier.
+func (c *CredentialsStore) SetVerifier(v Verifier) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.verifier = v
+	c.clearCaches()
+}
+
+// verifierCompare adapts v to the signature of comparePassword.
+func verifierCompare(v Verifier) func(stored, given string) error {
+	return func(stored, given string) error {
+		if !v.Verify(stored, given) {
+			return ErrBadPassword
+		}
+		return nil
+	}
+}
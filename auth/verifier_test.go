@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// saltedSHA256Verifier verifies passwords stored as "sha256$<salt>$<hex digest
+// of salt+password>", falling back to DefaultVerifier for anything else.
+type saltedSHA256Verifier struct {
+	calls int64
+}
+
+func (v *saltedSHA256Verifier) Verify(stored, given string) bool {
+	atomic.AddInt64(&v.calls, 1)
+	parts := strings.Split(stored, "$")
+	if len(parts) != 3 || parts[0] != "sha256" {
+		return DefaultVerifier.Verify(stored, given)
+	}
+	sum := sha256.Sum256([]byte(parts[1] + given))
+	return constantTimeEqual(hex.EncodeToString(sum[:]), parts[2])
+}
+
+func mustSaltedSHA256(salt, password string) string {
+	sum := sha256.Sum256([]byte(salt + password))
+	return "sha256$" + salt + "$" + hex.EncodeToString(sum[:])
+}
+
+func Test_Verifier(t *testing.T) {
+	store := NewCredentialsStore()
+	for _, cred := range []Credential{
+		{Username: "username1", Password: mustSaltedSHA256("salt", "password1")},
+		{Username: "username2", Password: mustBcrypt(t, "password2")},
+		{Username: "username3", Password: "password3"},
+	} {
+		if err := store.AddUser(cred); err != nil {
+			t.Fatalf("failed to add user: %s", err.Error())
+		}
+	}
+
+	if store.Check("username1", "password1") {
+		t.Fatalf("legacy password accepted without verifier")
+	}
+
+	v := &saltedSHA256Verifier{}
+	store.SetVerifier(v)
+	for _, tt := range []struct {
+		username string
+		password string
+		exp      bool
+	}{
+		{"username1", "password1", true},
+		{"username1", "wrong", false},
+		{"username2", "password2", true},
+		{"username2", "wrong", false},
+		{"username3", "password3", true},
+		{"username3", "wrong", false},
+	} {
+		if got := store.Check(tt.username, tt.password); got != tt.exp {
+			t.Fatalf("Check(%q, %q) = %v, exp %v", tt.username, tt.password, got, tt.exp)
+		}
+	}
+
+	// Successful verifications are cached.
+	calls := atomic.LoadInt64(&v.calls)
+	if !store.Check("username1", "password1") {
+		t.Fatalf("username1 not authenticated")
+	}
+	if got := atomic.LoadInt64(&v.calls); got != calls {
+		t.Fatalf("verifier called for cached verification")
+	}
+
+	store.SetVerifier(nil)
+	if store.Check("username1", "password1") {
+		t.Fatalf("legacy password accepted after verifier removed")
+	}
+}
@@ -0,0 +1,22 @@
+package auth
+
+import "fmt"
+
+// SetWarningHook sets a function called with a description of each problem the
+// store tolerates but an operator may want to know about, such as an empty
+// perm dropped while loading credentials. The hook is called with the store
+// locked, so must not call back into the store. Passing nil, the default,
+// discards warnings.
+func (c *CredentialsStore) SetWarningHook(hook func(msg string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warningHook = hook
+}
+
+// warn passes a warning, formatted as by fmt.Sprintf, to the warning hook if one
+// is set. The caller must hold the read lock.
+func (c *CredentialsStore) warn(format string, a ...any) {
+	if c.warningHook != nil {
+		c.warningHook(fmt.Sprintf(format, a...))
+	}
+}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long WatchFile and WatchSplit wait after a change to a
+// watched file before reloading it, so that a rapid sequence of writes causes
+// one reload.
+const watchDebounce = 100 * time.Millisecond
+
+// SetReloadCallback sets a function which is called after each reload performed
+// by WatchFile or WatchSplit, with the path reloaded, and the error if the
+// reload failed. Passing nil removes the callback.
+func (c *CredentialsStore) SetReloadCallback(fn func(path string, err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reloadCallback = fn
+}
+
+// WatchFile watches the credentials file at path, and reloads the store from
+// it via ReloadFromFile whenever it changes, until ctx is done. If the file
+// cannot be loaded, for example because it is malformed, the error is logged
+// and the store keeps its previous credentials. An error is returned only if
+// the file cannot be watched; watching happens in the background.
+func (c *CredentialsStore) WatchFile(ctx context.Context, path string) error {
+	return c.watch(ctx, []string{filepath.Clean(path)}, c.ReloadFromFile)
+}
+
+// WatchSplit is like WatchFile, but for credentials split across two files:
+// one at passwordPath holding the credentials, as read by Load, and one at
+// permsPath holding perms, as read by LoadInvertedPerms. Both files are loaded
+// before WatchSplit returns, and an error is returned, leaving the store
+// unchanged, if either cannot be. Thereafter each file is reloaded
+// independently whenever it changes, and the store is replaced with the
+// credentials of the one merged with the perms of the other. If a file cannot
+// be reloaded, the last version of it loaded is used in its place, so a bad
+// perms file never disturbs passwords, nor a bad password file perms. Perms
+// granted to a user not in the password file are ignored until the user is
+// added to it, except those granted to AllUsers and AuthedUsers.
+func (c *CredentialsStore) WatchSplit(ctx context.Context, passwordPath, permsPath string) error {
+	s := &splitFiles{
+		c:            c,
+		passwordPath: filepath.Clean(passwordPath),
+		permsPath:    filepath.Clean(permsPath),
+	}
+	creds, err := readCredentialsFile(s.passwordPath)
+	if err != nil {
+		return err
+	}
+	perms, err := readInvertedPermsFile(s.permsPath)
+	if err != nil {
+		return err
+	}
+	if err := s.replace(creds, perms); err != nil {
+		return err
+	}
+	return c.watch(ctx, []string{s.passwordPath, s.permsPath}, s.reload)
+}
+
+// splitFiles holds the last versions loaded of the files watched by
+// WatchSplit. It is used only by the goroutine watching them, once loaded.
+type splitFiles struct {
+	c            *CredentialsStore
+	passwordPath string
+	permsPath    string
+	creds        []Credential
+	perms        map[string][]string
+}
+
+// reload rereads the file at path, which must be one of those watched, and
+// replaces the store's credentials with those of both files.
+func (s *splitFiles) reload(path string) error {
+	creds, perms := s.creds, s.perms
+	var err error
+	if path == s.passwordPath {
+		creds, err = readCredentialsFile(path)
+	} else {
+		perms, err = readInvertedPermsFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	return s.replace(creds, perms)
+}
+
+// replace replaces the store's credentials with creds, merged with perms,
+// and records both as the last versions loaded if successful.
+func (s *splitFiles) replace(creds []Credential, perms map[string][]string) error {
+	if err := s.c.ReplaceAll(s.c.mergeInvertedPerms(creds, perms)); err != nil {
+		return err
+	}
+	s.creds, s.perms = creds, perms
+	return nil
+}
+
+// mergeInvertedPerms returns a copy of creds with the perms in inverted, which
+// maps each perm to the usernames granted it, added to those of each user.
+// Perms granted to a username not in creds are dropped, unless it is AllUsers
+// or AuthedUsers, which are added. creds itself is not modified.
+func (c *CredentialsStore) mergeInvertedPerms(creds []Credential, inverted map[string][]string) []Credential {
+	merged := slices.Clone(creds)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	index := make(map[string]int, len(merged))
+	for i, cred := range merged {
+		index[c.normalize(cred.Username)] = i
+	}
+	for perm, usernames := range inverted {
+		for _, u := range usernames {
+			i, ok := index[c.normalize(u)]
+			if !ok {
+				if u != AllUsers && u != AuthedUsers {
+					continue
+				}
+				merged = append(merged, Credential{Username: u})
+				i = len(merged) - 1
+				index[u] = i
+			}
+			merged[i].Perms = append(slices.Clip(merged[i].Perms), perm)
+		}
+	}
+	return merged
+}
+
+// readCredentialsFile reads a JSON array of Credentials from the file at path.
+func readCredentialsFile(path string) ([]Credential, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeCredentials(f)
+}
+
+// readInvertedPermsFile reads perms, in the form read by LoadInvertedPerms, from
+// the file at path.
+func readInvertedPermsFile(path string) (map[string][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var inverted map[string][]string
+	if err := json.NewDecoder(f).Decode(&inverted); err != nil {
+		return nil, err
+	}
+	return inverted, nil
+}
+
+// watch watches the files at paths, which must be clean, calling reload with the path of each which
+// changes, until ctx is done. Changes to any of the files within watchDebounce
+// of each other are handled together, each file changed being reloaded once,
+// in the order given by paths. Each reload is logged, and reported to the
+// reload callback.
+func (c *CredentialsStore) watch(ctx context.Context, paths []string, reload func(path string) error) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// Watch the directories, so a file is still watched if it is replaced
+	// by renaming another file over it, as many editors do.
+	for _, path := range paths {
+		if err := w.Add(filepath.Dir(path)); err != nil {
+			w.Close()
+			return err
+		}
+	}
+
+	logger := log.New(os.Stderr, "[auth] ", log.LstdFlags)
+	go func() {
+		defer w.Close()
+		var timer *time.Timer
+		var fire <-chan time.Time
+		changed := make(map[string]bool)
+		for {
+			select {
+			case <-ctx.Done():
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if !slices.Contains(paths, ev.Name) || !ev.Has(fsnotify.Write) && !ev.Has(fsnotify.Create) {
+					continue
+				}
+				changed[ev.Name] = true
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.NewTimer(watchDebounce)
+				fire = timer.C
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				logger.Printf("error watching credentials files %s: %s", strings.Join(paths, ", "), err.Error())
+			case <-fire:
+				fire = nil
+				for _, path := range paths {
+					if !changed[path] {
+						continue
+					}
+					delete(changed, path)
+					err := reload(path)
+					if err != nil {
+						logger.Printf("failed to reload credentials from %s, keeping previous credentials: %s",
+							path, err.Error())
+					} else {
+						logger.Printf("reloaded credentials from %s", path)
+					}
+					c.mu.RLock()
+					fn := c.reloadCallback
+					c.mu.RUnlock()
+					if fn != nil {
+						fn(path, err)
+					}
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_WatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.json")
+	mustWriteFile(t, path, `[{"username": "username1", "password": "password1"}]`)
+	store, err := NewCredentialsStoreFromFile(path)
+	if err != nil {
+		t.Fatalf("failed to load credentials: %s", err.Error())
+	}
+
+	reloads := make(chan error, 10)
+	store.SetReloadCallback(func(p string, err error) {
+		if p != path {
+			t.Errorf("wrong path in callback, exp %s, got %s", path, p)
+		}
+		reloads <- err
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := store.WatchFile(ctx, path); err != nil {
+		t.Fatalf("failed to watch file: %s", err.Error())
+	}
+
+	// A rapid sequence of writes causes a single reload.
+	mustWriteFile(t, path, `[{"username": "username1", "password": "password2"}]`)
+	mustWriteFile(t, path, `[{"username": "username2", "password": "password2"}]`)
+	if err := mustWaitReload(t, reloads); err != nil {
+		t.Fatalf("reload failed: %s", err.Error())
+	}
+	select {
+	case <-reloads:
+		t.Fatalf("more than one reload for rapid writes")
+	case <-time.After(3 * watchDebounce):
+	}
+	if store.Check("username1", "password1") || !store.Check("username2", "password2") {
+		t.Fatalf("credentials not reloaded")
+	}
+
+	// A malformed file is reported, and the previous credentials kept.
+	mustWriteFile(t, path, `[{"username": "username3"`)
+	if err := mustWaitReload(t, reloads); err == nil {
+		t.Fatalf("expected error reloading malformed file")
+	}
+	if !store.Check("username2", "password2") {
+		t.Fatalf("previous credentials not kept after failed reload")
+	}
+
+	// Replacing the file by renaming another over it is detected.
+	tmp := filepath.Join(filepath.Dir(path), "auth.json.tmp")
+	mustWriteFile(t, tmp, `[{"username": "username4", "password": "password4"}]`)
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("failed to rename file: %s", err.Error())
+	}
+	if err := mustWaitReload(t, reloads); err != nil {
+		t.Fatalf("reload failed: %s", err.Error())
+	}
+	if !store.Check("username4", "password4") {
+		t.Fatalf("credentials not reloaded after rename")
+	}
+
+	// No reloads once the context is done.
+	cancel()
+	time.Sleep(watchDebounce)
+	mustWriteFile(t, path, `[{"username": "username5", "password": "password5"}]`)
+	select {
+	case <-reloads:
+		t.Fatalf("reload after context done")
+	case <-time.After(3 * watchDebounce):
+	}
+}
+
+func Test_WatchFileNoDir(t *testing.T) {
+	store := NewCredentialsStore()
+	path := filepath.Join(t.TempDir(), "missing", "auth.json")
+	if err := store.WatchFile(context.Background(), path); err == nil {
+		t.Fatalf("expected error watching file in missing directory")
+	}
+}
+
+func Test_WatchSplit(t *testing.T) {
+	dir := t.TempDir()
+	pwPath := filepath.Join(dir, "passwords.json")
+	permsPath := filepath.Join(dir, "perms.json")
+	mustWriteFile(t, pwPath, `[{"username": "username1", "password": "password1"}, {"username": "username2", "password": "password2"}]`)
+	mustWriteFile(t, permsPath, `{"query": ["username1", "username3"], "status": ["*"]}`)
+
+	store := NewCredentialsStore()
+	reloads := make(chan error, 10)
+	store.SetReloadCallback(func(p string, err error) {
+		reloads <- err
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := store.WatchSplit(ctx, pwPath, permsPath); err != nil {
+		t.Fatalf("failed to watch files: %s", err.Error())
+	}
+	if !store.Check("username1", "password1") || !store.HasPerm("username1", PermQuery) {
+		t.Fatalf("username1 not loaded from both files")
+	}
+	if !store.HasPerm("username2", PermStatus) {
+		t.Fatalf("AllUsers perm not loaded")
+	}
+	if store.HasPerm("username3", PermQuery) {
+		t.Fatalf("perm granted to user not in password file")
+	}
+
+	// Changing the perms file changes only perms.
+	mustWriteFile(t, permsPath, `{"query": ["username2"]}`)
+	if err := mustWaitReload(t, reloads); err != nil {
+		t.Fatalf("reload failed: %s", err.Error())
+	}
+	if store.HasPerm("username1", PermQuery) || !store.HasPerm("username2", PermQuery) {
+		t.Fatalf("perms not reloaded")
+	}
+	if !store.Check("username1", "password1") || !store.Check("username2", "password2") {
+		t.Fatalf("passwords changed by reloading perms")
+	}
+
+	// Changing the password file changes only passwords.
+	mustWriteFile(t, pwPath, `[{"username": "username1", "password": "passwordX"}, {"username": "username2", "password": "password2"}, {"username": "username3", "password": "password3"}]`)
+	if err := mustWaitReload(t, reloads); err != nil {
+		t.Fatalf("reload failed: %s", err.Error())
+	}
+	if store.Check("username1", "password1") || !store.Check("username1", "passwordX") {
+		t.Fatalf("passwords not reloaded")
+	}
+	if store.HasPerm("username1", PermQuery) || !store.HasPerm("username2", PermQuery) {
+		t.Fatalf("perms changed by reloading passwords")
+	}
+
+	// A malformed perms file leaves the store as it was, and a later change
+	// to the password file is merged with the last good perms.
+	mustWriteFile(t, permsPath, `{"query": [`)
+	if err := mustWaitReload(t, reloads); err == nil {
+		t.Fatalf("expected error reloading malformed perms file")
+	}
+	if !store.HasPerm("username2", PermQuery) || !store.Check("username1", "passwordX") {
+		t.Fatalf("store changed by failed reload of perms")
+	}
+	mustWriteFile(t, pwPath, `[{"username": "username2", "password": "passwordY"}]`)
+	if err := mustWaitReload(t, reloads); err != nil {
+		t.Fatalf("reload failed: %s", err.Error())
+	}
+	if !store.Check("username2", "passwordY") || !store.HasPerm("username2", PermQuery) {
+		t.Fatalf("passwords not merged with last good perms")
+	}
+
+	// Likewise a malformed password file, with a later change to perms.
+	mustWriteFile(t, pwPath, `[{"username": "username2"`)
+	if err := mustWaitReload(t, reloads); err == nil {
+		t.Fatalf("expected error reloading malformed password file")
+	}
+	mustWriteFile(t, permsPath, `{"status": ["username2"]}`)
+	if err := mustWaitReload(t, reloads); err != nil {
+		t.Fatalf("reload failed: %s", err.Error())
+	}
+	if !store.Check("username2", "passwordY") {
+		t.Fatalf("passwords changed by failed reload")
+	}
+	if store.HasPerm("username2", PermQuery) || !store.HasPerm("username2", PermStatus) {
+		t.Fatalf("perms not merged with last good passwords")
+	}
+}
+
+func Test_WatchSplitBadFile(t *testing.T) {
+	dir := t.TempDir()
+	pwPath := filepath.Join(dir, "passwords.json")
+	permsPath := filepath.Join(dir, "perms.json")
+	mustWriteFile(t, pwPath, `[{"username": "username1", "password": "password1"}]`)
+	mustWriteFile(t, permsPath, `{"query": [`)
+
+	store := NewCredentialsStore()
+	if err := store.AddUser(Credential{Username: "username2", Password: "password2"}); err != nil {
+		t.Fatalf("failed to add user: %s", err.Error())
+	}
+	if err := store.WatchSplit(context.Background(), pwPath, permsPath); err == nil {
+		t.Fatalf("expected error for malformed perms file")
+	}
+	if store.Check("username1", "password1") || !store.Check("username2", "password2") {
+		t.Fatalf("store changed by failed load")
+	}
+	if err := store.WatchSplit(context.Background(), filepath.Join(dir, "missing.json"), permsPath); err == nil {
+		t.Fatalf("expected error for missing password file")
+	}
+}
+
+func mustWriteFile(t *testing.T, path, s string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(s), 0600); err != nil {
+		t.Fatalf("failed to write file: %s", err.Error())
+	}
+}
+
+func mustWaitReload(t *testing.T, reloads <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-reloads:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for reload")
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadYAML is like Load, but reads the credentials from a YAML sequence of
+// Credentials, each a mapping with the same keys as the JSON accepted by Load.
+func (c *CredentialsStore) LoadYAML(r io.Reader) error {
+	creds, err := decodeYAMLCredentials(r)
+	if err != nil {
+		return err
+	}
+	return c.load(creds)
+}
+
+// decodeYAMLCredentials reads a YAML sequence of Credentials from a reader. An
+// empty document holds no credentials.
+func decodeYAMLCredentials(r io.Reader) ([]Credential, error) {
+	var creds []Credential
+	if err := yaml.NewDecoder(r).Decode(&creds); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// NewCredentialsStoreFromYAMLFile returns a new instance of a CredentialStore
+// loaded from a YAML file.
+func NewCredentialsStoreFromYAMLFile(path string) (*CredentialsStore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := NewCredentialsStore()
+	return c, c.LoadYAML(f)
+}
+
+func isYAMLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
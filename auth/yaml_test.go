@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const yamlStream = `
+- username: username1
+  password: password1
+  perms: [foo, bar]
+- username: username2
+  password: password2
+  perms:
+    - baz
+  tenant: a
+`
+
+func Test_LoadYAML(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.LoadYAML(strings.NewReader(yamlStream)); err != nil {
+		t.Fatalf("failed to load YAML: %s", err.Error())
+	}
+
+	if !store.Check("username1", "password1") {
+		t.Fatalf("single credential not loaded correctly")
+	}
+	if !store.Check("username2", "password2") {
+		t.Fatalf("single credential not loaded correctly")
+	}
+	if !store.HasPerm("username1", "foo") || !store.HasPerm("username1", "bar") {
+		t.Fatalf("username1 does not have expected perms")
+	}
+	if !store.HasTenantPerm("a", "username2", "baz") {
+		t.Fatalf("username2 does not have expected perm in tenant")
+	}
+
+	// YAML and JSON of the same credentials produce the same store.
+	jsonStore := NewCredentialsStore()
+	if err := jsonStore.Load(strings.NewReader(`[
+		{"username": "username1", "password": "password1", "perms": ["foo", "bar"]},
+		{"username": "username2", "password": "password2", "perms": ["baz"], "tenant": "a"}
+	]`)); err != nil {
+		t.Fatalf("failed to load JSON: %s", err.Error())
+	}
+	if !reflect.DeepEqual(store.credentials(), jsonStore.credentials()) {
+		t.Fatalf("YAML and JSON stores differ")
+	}
+}
+
+func Test_LoadYAMLEmpty(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.LoadYAML(strings.NewReader("")); err != nil {
+		t.Fatalf("failed to load empty YAML: %s", err.Error())
+	}
+	if err := store.LoadYAML(strings.NewReader("[]")); err != nil {
+		t.Fatalf("failed to load empty YAML sequence: %s", err.Error())
+	}
+}
+
+func Test_LoadYAMLMalformed(t *testing.T) {
+	store := NewCredentialsStore()
+	if err := store.LoadYAML(strings.NewReader("username: username1")); err == nil {
+		t.Fatalf("expected error for YAML which is not a sequence")
+	}
+	if err := store.LoadYAML(strings.NewReader("- username: username1\n- username: username1")); err == nil {
+		t.Fatalf("expected error for duplicate username")
+	}
+}
+
+func Test_NewCredentialsStoreFromYAMLFile(t *testing.T) {
+	for _, name := range []string{"auth.yaml", "auth.YML"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(yamlStream), 0600); err != nil {
+			t.Fatalf("failed to write file: %s", err.Error())
+		}
+
+		for _, fn := range []func(string) (*CredentialsStore, error){
+			NewCredentialsStoreFromYAMLFile,
+			NewCredentialsStoreFromFile,
+		} {
+			store, err := fn(path)
+			if err != nil {
+				t.Fatalf("failed to load %s: %s", name, err.Error())
+			}
+			if !store.Check("username1", "password1") {
+				t.Fatalf("credential not loaded from %s", name)
+			}
+		}
+	}
+}
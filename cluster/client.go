@@ -44,7 +44,9 @@ func CreateRaftDialer(cert, key, caCert, serverName string, Insecure bool) (*tcp
 }
 
 // CredentialsFor returns a Credentials instance for the given username, or nil if
-// the given CredentialsStore is nil, or the username is not found.
+// the given CredentialsStore is nil, or the username is not found. The password
+// is the one stored, so peers accept it only if they store the same password,
+// which is not the case if the store sets HashPlaintextOnLoad or RehashCost.
 func CredentialsFor(credStr *auth.CredentialsStore, username string) *proto.Credentials {
 	if credStr == nil {
 		return nil
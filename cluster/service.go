@@ -119,8 +119,10 @@ type Manager interface {
 
 // CredentialStore is the interface credential stores must support.
 type CredentialStore interface {
-	// AA authenticates and checks authorization for the given perm.
-	AA(username, password, perm string) bool
+	// AAFromNode authenticates and checks authorization for the given perm,
+	// for a request from another node, which may supply the password of a
+	// user as stored.
+	AAFromNode(username, password, perm string) bool
 }
 
 // Service provides information about the node and cluster.
@@ -237,7 +239,7 @@ func (s *Service) checkCommandPerm(c *proto.Command, perm string) bool {
 		username = c.Credentials.GetUsername()
 		password = c.Credentials.GetPassword()
 	}
-	return s.credentialStore.AA(username, password, perm)
+	return s.credentialStore.AAFromNode(username, password, perm)
 }
 
 func (s *Service) checkCommandPermAll(c *proto.Command, perms ...string) bool {
@@ -252,7 +254,7 @@ func (s *Service) checkCommandPermAll(c *proto.Command, perms ...string) bool {
 		password = c.Credentials.GetPassword()
 	}
 	for _, perm := range perms {
-		if !s.credentialStore.AA(username, password, perm) {
+		if !s.credentialStore.AAFromNode(username, password, perm) {
 			return false
 		}
 	}
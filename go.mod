@@ -5,6 +5,7 @@ go 1.21
 require (
 	github.com/Bowery/prompt v0.0.0-20190916142128-fa8279994f75
 	github.com/aws/aws-sdk-go v1.49.23
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/hashicorp/go-hclog v1.6.2
 	github.com/hashicorp/raft v1.6.0
 	github.com/mkideal/cli v0.2.7
@@ -14,8 +15,10 @@ require (
 	github.com/rqlite/rqlite-disco-clients v0.0.0-20231230135307-118e35426347
 	github.com/rqlite/sql v0.0.0-20240102050638-e741e9f54197
 	go.etcd.io/bbolt v1.3.8
+	golang.org/x/crypto v0.18.0
 	golang.org/x/net v0.20.0
 	google.golang.org/protobuf v1.32.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -47,7 +50,6 @@ require (
 	go.etcd.io/etcd/client/v3 v3.5.11 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.26.0 // indirect
-	golang.org/x/crypto v0.18.0 // indirect
 	golang.org/x/exp v0.0.0-20240112132812-db7319d0e0e3 // indirect
 	golang.org/x/sys v0.16.0 // indirect
 	golang.org/x/term v0.16.0 // indirect
@@ -1023,7 +1023,7 @@ type mockCredentialStore struct {
 	aaFunc    func(username, password, perm string) bool
 }
 
-func (m *mockCredentialStore) AA(username, password, perm string) bool {
+func (m *mockCredentialStore) AAFromNode(username, password, perm string) bool {
 	if m == nil {
 		return true
 	}